@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+)
+
+const benchNode = "emq@127.0.0.1"
+
+// benchResponses are the v4 API responses served by the mock broker
+var benchResponses = map[string]string{
+	"/api/v4/nodes": `{"code":0,"data":[{"name":"` + benchNode + `","version":"4.2.14","otp_release":"R21/10.3.2","node_status":"Running","uptime":"1 days"}]}`,
+	"/api/v4/nodes/" + benchNode: `{"code":0,"data":{"name":"` + benchNode + `","otp_release":"R21/10.3.2","node_status":"Running",` +
+		`"memory_total":"512.00M","memory_used":"256.00M","process_available":2097152,"process_used":512,` +
+		`"max_fds":1048576,"used_fds":64,"connections":100,"load1":"0.10","load5":"0.20","load15":"0.30"}}`,
+	"/api/v4/nodes/" + benchNode + "/metrics": `{"code":0,"data":{"bytes.received":1000,"bytes.sent":2000,` +
+		`"packets.received":300,"packets.sent":400,"packets.publish.received":50,"packets.publish.sent":60,` +
+		`"messages.received":70,"messages.sent":80,"messages.qos0.sent":10,"messages.qos1.sent":20,` +
+		`"messages.qos2.sent":30,"messages.dropped":1,"messages.expired":2,"messages.forward":3}}`,
+	"/api/v4/nodes/" + benchNode + "/stats": `{"code":0,"data":{"connections.count":100,"connections.max":120,` +
+		`"channels.count":110,"channels.max":130,"sessions.count":110,"sessions.max":130,"topics.count":40,` +
+		`"topics.max":50,"subscriptions.count":90,"subscriptions.max":95,"routes.count":40,"routes.max":50}}`,
+	"/api/v4/brokers/" + benchNode: `{"code":0,"data":{"name":"` + benchNode + `","version":"4.2.14",` +
+		`"sysdescr":"EMQ X Broker","uptime":"1 days,18 hours, 45 minutes, 1 seconds","datetime":"2021-03-01 12:00:00","node_status":"Running"}}`,
+}
+
+// benchCase is a collector configuration measured by the benchmark
+type benchCase struct {
+	name string
+	opts collector.Options
+}
+
+var benchCases = []benchCase{
+	{name: "default", opts: collector.Options{MemoryUnitBase: emqapi.BinaryUnitBase}},
+	{name: "labeled-families", opts: collector.Options{MemoryUnitBase: emqapi.BinaryUnitBase, LabeledFamilies: true}},
+	{name: "legacy-names", opts: collector.Options{MemoryUnitBase: emqapi.BinaryUnitBase, LegacyNames: true}},
+	{name: "compat-window", opts: collector.Options{MemoryUnitBase: emqapi.BinaryUnitBase, CompatUntil: time.Now().Add(time.Hour)}},
+	{name: "min-scrape-interval", opts: collector.Options{MemoryUnitBase: emqapi.BinaryUnitBase, MinScrapeInterval: time.Hour}},
+}
+
+// benchResult holds the measurements of a benchmark case
+type benchResult struct {
+	scrapes   int
+	elapsed   time.Duration
+	allocs    uint64
+	bytes     uint64
+	latencies []time.Duration
+}
+
+func (r *benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(float64(len(r.latencies)-1)*p)]
+}
+
+// mockBroker serves fixed v4 API responses for a single node
+func mockBroker() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := benchResponses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+}
+
+// runBench scrapes n targets of a mock broker for the given duration with
+// every benchmark case and writes the throughput, allocations and latency to w
+func runBench(w io.Writer, n int, duration time.Duration) error {
+	if n < 1 {
+		return fmt.Errorf("the benchmark needs at least one target")
+	}
+	broker := mockBroker()
+	defer broker.Close()
+
+	cfg := &config.Config{}
+	for i := 0; i < n; i++ {
+		cfg.Targets = append(cfg.Targets, config.TargetConfig{
+			Name: fmt.Sprintf("target-%d", i),
+			URI:  broker.URL,
+			Node: benchNode,
+		})
+	}
+	api, err := emqapi.FindAPIVersion("v4")
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tSCRAPES/S\tALLOCS/SCRAPE\tBYTES/SCRAPE\tP50\tP99")
+	for _, bc := range benchCases {
+		set, err := buildTargets(cfg, config.TargetConfig{}, api, bc.opts, emqapi.Options{})
+		if err != nil {
+			return err
+		}
+		res, err := benchTargets(set, duration)
+		if err != nil {
+			return fmt.Errorf("%s: %s", bc.name, err)
+		}
+		scrapes := uint64(res.scrapes)
+		fmt.Fprintf(tw, "%s\t%.1f\t%d\t%d\t%s\t%s\n",
+			bc.name,
+			float64(res.scrapes)/res.elapsed.Seconds(),
+			res.allocs/scrapes,
+			res.bytes/scrapes,
+			res.percentile(0.5),
+			res.percentile(0.99),
+		)
+	}
+	return tw.Flush()
+}
+
+// benchTargets gathers the target set repeatedly until duration has passed
+func benchTargets(set *targetSet, duration time.Duration) (*benchResult, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	res := &benchResult{}
+	start := time.Now()
+	for time.Since(start) < duration || res.scrapes == 0 {
+		scrapeStart := time.Now()
+		if _, err := set.GatherContext(context.Background()); err != nil {
+			return nil, err
+		}
+		res.latencies = append(res.latencies, time.Since(scrapeStart))
+		res.scrapes++
+	}
+	res.elapsed = time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	res.allocs = after.Mallocs - before.Mallocs
+	res.bytes = after.TotalAlloc - before.TotalAlloc
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+	return res, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// scrapeTimeoutHeader is sent by Prometheus with the timeout of the scrape
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// promLogger logs the errors of the metrics handler
+type promLogger struct{}
+
+func (promLogger) Println(v ...interface{}) {
+	log.Errorln(v...)
+}
+
+type gathererFunc func() ([]*dto.MetricFamily, error)
+
+func (f gathererFunc) Gather() ([]*dto.MetricFamily, error) {
+	return f()
+}
+
+// scrapeDeadlineHandler serves the metrics with the API requests bound to
+// the scrape timeout announced by Prometheus, minus offset, so the exporter
+// answers before Prometheus gives up on the scrape. The target URL parameter
+// limits the scrape to a single named target, the metrics of base are
+// served in any case. If allowNode is set, the node URL parameter scrapes
+// another node of the cluster of the target in its place.
+func scrapeDeadlineHandler(base prometheus.Gatherer, targets *targetsGatherer, offset time.Duration, allowNode bool, opts promhttp.HandlerOpts) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set := targets.current()
+		if name := r.URL.Query().Get("target"); name != "" {
+			var ok bool
+			if set, ok = set.only(name); !ok {
+				http.Error(w, "unknown target "+name, http.StatusNotFound)
+				return
+			}
+		}
+		if node := r.URL.Query().Get("node"); node != "" {
+			if !allowNode {
+				http.Error(w, "the node parameter is disabled", http.StatusForbidden)
+				return
+			}
+			var ok bool
+			if set, ok = set.forNode(node); !ok {
+				http.Error(w, "the node parameter requires the target parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx := r.Context()
+		if v := r.Header.Get(scrapeTimeoutHeader); v != "" {
+			seconds, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				log.Warnf("Invalid %s header %q: %s", scrapeTimeoutHeader, v, err)
+			} else {
+				timeout := time.Duration(seconds*float64(time.Second)) - offset
+				if timeout <= 0 {
+					timeout = time.Duration(seconds * float64(time.Second))
+				}
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+
+		gatherer := prometheus.Gatherers{
+			base,
+			gathererFunc(func() ([]*dto.MetricFamily, error) {
+				return set.GatherContext(ctx)
+			}),
+		}
+		promhttp.HandlerFor(gatherer, opts).ServeHTTP(w, r)
+	})
+}
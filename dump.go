@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// secretKeyRE matches the JSON keys whose values are redacted from the
+// dumped responses
+var secretKeyRE = regexp.MustCompile(`(?i)pass|secret|token|api_?key|credential|cookie`)
+
+// unsafeFileRE matches the characters replaced in the names of dump files
+var unsafeFileRE = regexp.MustCompile(`[^a-zA-Z0-9_.@-]+`)
+
+// redacted replaces the values of secret keys
+const redacted = "<redacted>"
+
+// redact replaces the values of the secret keys of a decoded JSON value
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if secretKeyRE.MatchString(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redact(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+	}
+	return v
+}
+
+// responseDumper writes the raw API responses to timestamped files in dir,
+// so users can share the payloads of their broker version
+type responseDumper struct {
+	dir string
+}
+
+// dump writes the body of a response with the secrets redacted, bodies
+// which are not JSON are written as they are
+func (d *responseDumper) dump(node, endpoint string, body []byte) {
+	out := body
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err == nil {
+		if b, err := json.MarshalIndent(redact(v), "", "  "); err == nil {
+			out = b
+		}
+	}
+
+	name := time.Now().UTC().Format("20060102T150405.000000000Z") + "_" +
+		unsafeFileRE.ReplaceAllString(node, "_") + "_" +
+		unsafeFileRE.ReplaceAllString(endpoint, "_") + ".json"
+	if err := ioutil.WriteFile(filepath.Join(d.dir, name), out, 0600); err != nil {
+		log.Warnf("Failed to dump the %s response of %s: %s", endpoint, node, err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+)
+
+// acceptHeaders are the Accept headers selecting each exposition format in
+// the content negotiation of the metrics handler
+var acceptHeaders = map[string]string{
+	"text":     "text/plain; version=0.0.4",
+	"protobuf": "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited",
+}
+
+// forceFormat makes the metrics handler answer in the given exposition
+// format regardless of the Accept header sent by the scraper, "auto" keeps
+// the negotiated format
+func forceFormat(format string, next http.Handler) http.Handler {
+	accept, ok := acceptHeaders[format]
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Accept", accept)
+		next.ServeHTTP(w, r)
+	})
+}
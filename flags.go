@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// secretFlagRE matches the names of the flags whose values are not exported
+var secretFlagRE = regexp.MustCompile(`password|token|secret`)
+
+// flagValue returns the value of a flag with the passwords of URLs removed
+func flagValue(f *kingpin.FlagModel) string {
+	return removePassword(f.String())
+}
+
+// removePassword removes the password of a URL or of a
+// user:password@host:port address like the one of --emq.socks5-proxy
+func removePassword(value string) string {
+	// without a scheme, user:password@host would parse as scheme "user"
+	raw := value
+	if !strings.Contains(value, "://") {
+		raw = "//" + value
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	u.User = url.User(u.User.Username())
+	if raw != value {
+		return strings.TrimPrefix(u.String(), "//")
+	}
+	return u.String()
+}
+
+var flagsInfoName = prometheus.BuildFQName(collector.Namespace, "exporter", "flags_info")
+
+// newFlagsInfo returns the info metric of the flags of app, one series per
+// flag with its value, leaving out the secrets and the flags of kingpin
+func newFlagsInfo(app *kingpin.Application) *prometheus.GaugeVec {
+	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: flagsInfoName,
+		Help: "Values of the command line flags of the exporter, without secrets, the value is always 1.",
+	}, []string{"flag", "value"})
+	for _, f := range app.Model().Flags {
+		if f.Name == "version" || strings.HasPrefix(f.Name, "help") || strings.HasPrefix(f.Name, "completion-") {
+			continue
+		}
+		if secretFlagRE.MatchString(f.Name) {
+			continue
+		}
+		info.WithLabelValues(f.Name, flagValue(f)).Set(1)
+	}
+	return info
+}
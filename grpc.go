@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// grpcSnapshotPath is the method path of the metrics snapshot service:
+//
+//	service MetricsService {
+//	  rpc Snapshot(google.protobuf.Empty) returns (stream io.prometheus.client.MetricFamily);
+//	}
+const grpcSnapshotPath = "/emq_exporter.MetricsService/Snapshot"
+
+const (
+	grpcStatusOK       = 0
+	grpcStatusInternal = 13
+)
+
+// grpcHandler serves the current metric snapshot as a server-streaming gRPC
+// call. gRPC requires HTTP/2, so the handler must be served over TLS. The
+// targets are gathered with the API requests bound to the call.
+func grpcHandler(targets *targetsGatherer, base prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 ||
+			!strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.URL.Path != grpcSnapshotPath {
+			http.NotFound(w, r)
+			return
+		}
+		io.Copy(ioutil.Discard, r.Body)
+
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+
+		gatherer := prometheus.Gatherers{
+			gathererFunc(func() ([]*dto.MetricFamily, error) {
+				return targets.GatherContext(r.Context())
+			}),
+			base,
+		}
+		// like promhttp.ContinueOnError, the families gathered are still
+		// streamed when some targets fail
+		mfs, gatherErr := gatherer.Gather()
+		if gatherErr != nil {
+			log.Errorf("error gathering metrics for the gRPC snapshot: %s", gatherErr)
+		}
+
+		err := writeGRPCSnapshot(w, mfs)
+		if err != nil {
+			log.Errorf("failed to stream gRPC metric snapshot: %s", err)
+		} else {
+			err = gatherErr
+		}
+		if err != nil {
+			w.Header().Set("Grpc-Status", fmt.Sprint(grpcStatusInternal))
+			w.Header().Set("Grpc-Message", grpcEncodeMessage(err.Error()))
+			return
+		}
+		w.Header().Set("Grpc-Status", fmt.Sprint(grpcStatusOK))
+	})
+}
+
+func writeGRPCSnapshot(w http.ResponseWriter, mfs []*dto.MetricFamily) error {
+	for _, mf := range mfs {
+		b, err := proto.Marshal(mf)
+		if err != nil {
+			return err
+		}
+
+		// Every message is prefixed by a compression flag and its length
+		header := make([]byte, 5)
+		binary.BigEndian.PutUint32(header[1:], uint32(len(b)))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	return nil
+}
+
+// grpcEncodeMessage percent-encodes the Grpc-Message trailer, which may only
+// hold printable ASCII without the percent sign
+func grpcEncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
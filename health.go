@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// readyTimeout bounds the pings of the readiness check
+const readyTimeout = 5 * time.Second
+
+// targetHealth is the JSON summary of a target served on /targets
+type targetHealth struct {
+	Target         string    `json:"target"`
+	Node           string    `json:"node"`
+	Health         string    `json:"health"`
+	LastScrape     time.Time `json:"lastScrape"`
+	LastScrapeSecs float64   `json:"lastScrapeDuration"`
+	LastError      string    `json:"lastError"`
+	ErrorType      string    `json:"errorType,omitempty"`
+	APIVersion     string    `json:"apiVersion"`
+}
+
+var targetsTemplate = template.Must(template.New("targets").Parse(`<html>
+    <head><title>EMQ Exporter Targets</title></head>
+    <body>
+    <h1>Targets</h1>
+    <table border="1" cellpadding="4">
+    <tr><th>Target</th><th>Node</th><th>Health</th><th>API</th><th>Last scrape</th><th>Duration</th><th>Error</th></tr>
+    {{range .}}<tr><td>{{.Target}}</td><td>{{.Node}}</td><td>{{.Health}}</td><td>{{.APIVersion}}</td><td>{{if not .LastScrape.IsZero}}{{.LastScrape.Format "2006-01-02T15:04:05Z07:00"}}{{end}}</td><td>{{printf "%.3fs" .LastScrapeSecs}}</td><td>{{if .ErrorType}}{{.ErrorType}}: {{end}}{{.LastError}}</td></tr>
+    {{end}}</table>
+    </body>
+    </html>`))
+
+// targetsHandler summarizes the last scrape of every target, as HTML for
+// browsers and as JSON otherwise
+func targetsHandler(targets *targetsGatherer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		set := targets.current()
+		summary := make([]targetHealth, 0, len(set.targets))
+		for _, t := range set.targets {
+			h := t.collector.Health()
+			health := "unknown"
+			if !h.LastScrape.IsZero() {
+				health = "down"
+				if h.Up {
+					health = "up"
+				}
+			}
+			summary = append(summary, targetHealth{
+				Target:         t.name,
+				Node:           h.Node,
+				Health:         health,
+				LastScrape:     h.LastScrape,
+				LastScrapeSecs: h.Duration.Seconds(),
+				LastError:      h.LastError,
+				ErrorType:      h.ErrorType,
+				APIVersion:     h.APIVersion,
+			})
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			targetsTemplate.Execute(w, summary)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// readyHandler answers 200 when every target answers a ping on its brokers
+// endpoint and 503 otherwise. Unlike a scrape the pings add next to no load
+// to the management API of the brokers.
+func readyHandler(targets *targetsGatherer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		set := targets.current()
+		errs := make([]error, len(set.targets))
+		var wg sync.WaitGroup
+		for i, t := range set.targets {
+			wg.Add(1)
+			go func(i int, t *target) {
+				defer wg.Done()
+				errs[i] = t.client.Ping(ctx)
+			}(i, t)
+		}
+		wg.Wait()
+
+		var failed []string
+		for i, err := range errs {
+			if err != nil {
+				log.Warnf("Readiness check of target %q failed: %s", set.targets[i].name, err)
+				failed = append(failed, err.Error())
+			}
+		}
+		if len(failed) > 0 {
+			http.Error(w, strings.Join(failed, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "Ready")
+	}
+}
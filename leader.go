@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/larseen/emq_exporter/pkg/leader"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var leaderName = prometheus.BuildFQName(collector.Namespace, "exporter", "leader")
+
+// newElector returns the elector of the lock configured by the ha flags,
+// or nil if the replica always leads
+func newElector() (*leader.Elector, error) {
+	var lock leader.Lock
+	switch {
+	case *haLockFile != "" && *haLease != "":
+		return nil, fmt.Errorf("--ha.lock-file and --ha.lease cannot be combined")
+	case *haLockFile != "":
+		l, err := leader.NewFileLock(*haLockFile)
+		if err != nil {
+			return nil, err
+		}
+		lock = l
+	case *haLease != "":
+		identity := *haIdentity
+		if identity == "" {
+			var err error
+			if identity, err = os.Hostname(); err != nil {
+				return nil, err
+			}
+		}
+		l, err := leader.NewLeaseLock(*haLease, identity, *haLeaseDuration)
+		if err != nil {
+			return nil, err
+		}
+		lock = l
+	default:
+		return nil, nil
+	}
+
+	elector := leader.NewElector(lock, *haRetryPeriod)
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: leaderName,
+		Help: "Whether this replica of the exporter holds the lock and pushes and subscribes to $SYS.",
+	}, func() float64 {
+		if elector.Leading() {
+			return 1
+		}
+		return 0
+	}))
+	return elector, nil
+}
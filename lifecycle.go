@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	configLastReloadSuccessfulName = prometheus.BuildFQName(collector.Namespace, "exporter", "config_last_reload_successful")
+	configLastReloadTimeName       = prometheus.BuildFQName(collector.Namespace, "exporter", "config_last_reload_time_seconds")
+
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: configLastReloadSuccessfulName,
+		Help: "Whether the last configuration reload attempt was successful.",
+	})
+	configLastReloadTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: configLastReloadTimeName,
+		Help: "Timestamp of the last successful configuration reload in seconds since the epoch.",
+	})
+)
+
+// recordReload updates the reload metrics with the outcome of loading the
+// config file, the initial load counts as a reload like in Prometheus
+func recordReload(err error) {
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return
+	}
+	configLastReloadSuccessful.Set(1)
+	configLastReloadTime.SetToCurrentTime()
+}
+
+// builtinMetricNames returns the names of the metrics served by the
+// exporter itself, which the custom and derived metrics must not use
+func builtinMetricNames() []string {
+	return append(collector.BuiltinMetricNames(),
+		buildInfoName,
+		flagsInfoName,
+		leaderName,
+		configLastReloadSuccessfulName,
+		configLastReloadTimeName,
+		rejectedScrapesName,
+		inconsistentName,
+	)
+}
+
+// reloader swaps the served targets for ones built from a freshly loaded config file
+type reloader struct {
+	mtx      sync.Mutex
+	filename string
+	targets  *targetsGatherer
+	build    func(cfg *config.Config) (*targetSet, error)
+}
+
+func (r *reloader) reload() (err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	defer func() { recordReload(err) }()
+
+	cfg, err := config.Load(r.filename, builtinMetricNames())
+	if err != nil {
+		return err
+	}
+
+	set, err := r.build(cfg)
+	if err != nil {
+		return err
+	}
+	set.inherit(r.targets.current())
+	r.targets.swap(set)
+
+	log.Infof("Reloaded configuration from %q", r.filename)
+	return nil
+}
+
+// lifecycleHandler only lets POST requests carrying the lifecycle token through,
+// every request is rejected when no token is configured
+func lifecycleHandler(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (r *reloader) handleReload(w http.ResponseWriter, req *http.Request) {
+	if err := r.reload(); err != nil {
+		log.Errorf("Failed to reload configuration: %s", err)
+		http.Error(w, "failed to reload configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rejectedScrapesName = prometheus.BuildFQName(collector.Namespace, "exporter", "scrapes_rejected_total")
+
+var rejectedScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: rejectedScrapesName,
+	Help: "Number of scrapes rejected because the maximum number of concurrent scrapes was reached.",
+})
+
+// limitConcurrency answers 503 to the requests arriving while max requests
+// are already being served, 0 disables the limit
+func limitConcurrency(max int, next http.Handler) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	sem := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			rejectedScrapes.Inc()
+			http.Error(w, "too many concurrent scrapes", http.StatusServiceUnavailable)
+		}
+	})
+}
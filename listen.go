@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd
+// socket activation
+const systemdListenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd socket activation,
+// see sd_listen_fds(3)
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets were passed by systemd")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("no sockets were passed by systemd")
+	}
+	// the sockets are not passed on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := systemdListenFDsStart; fd < systemdListenFDsStart+n; fd++ {
+		l, err := fileListener(fd)
+		if err != nil {
+			return nil, fmt.Errorf("socket %d passed by systemd: %s", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// fileListener returns the listener of the inherited socket fd
+func fileListener(fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// inheritedListenersEnv names the sockets a previous process of the
+// exporter handed over on upgrade, one name per file descriptor from 3 on
+const inheritedListenersEnv = "EMQ_EXPORTER_LISTENERS"
+
+// inheritedListeners are the sockets handed over by the previous process,
+// by the name they are listened on with
+var inheritedListeners = make(map[string][]net.Listener)
+
+// openListeners are the sockets in use, which are handed over to the next
+// process on upgrade once listening is complete
+var (
+	openListenersMtx sync.Mutex
+	openListeners    []namedListener
+	listening        bool
+)
+
+type namedListener struct {
+	name string
+	l    net.Listener
+}
+
+// inheritListeners takes over the sockets handed over by the previous
+// process of the exporter, if it was started by an upgrade
+func inheritListeners() error {
+	names := os.Getenv(inheritedListenersEnv)
+	if names == "" {
+		return nil
+	}
+	os.Unsetenv(inheritedListenersEnv)
+
+	for i, name := range strings.Split(names, ",") {
+		fd := systemdListenFDsStart + i
+		l, err := fileListener(fd)
+		if err != nil {
+			return fmt.Errorf("socket %d handed over for %s: %s", fd, name, err)
+		}
+		inheritedListeners[name] = append(inheritedListeners[name], l)
+	}
+	return nil
+}
+
+// listen opens the listeners of name, one per address or the sockets
+// passed by systemd. The sockets handed over by the previous process are
+// used in their place after an upgrade.
+func listen(name string, addresses []string, systemd bool) ([]net.Listener, error) {
+	if inherited, ok := inheritedListeners[name]; ok {
+		delete(inheritedListeners, name)
+		return track(name, inherited), nil
+	}
+	if systemd {
+		listeners, err := systemdListeners()
+		if err != nil {
+			return nil, err
+		}
+		return track(name, listeners), nil
+	}
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return track(name, listeners), nil
+}
+
+// track adds the listeners of name to the open listeners
+func track(name string, listeners []net.Listener) []net.Listener {
+	openListenersMtx.Lock()
+	defer openListenersMtx.Unlock()
+	for _, l := range listeners {
+		openListeners = append(openListeners, namedListener{name: name, l: l})
+	}
+	return listeners
+}
+
+// listeningComplete marks all listeners of the exporter as open
+func listeningComplete() {
+	openListenersMtx.Lock()
+	defer openListenersMtx.Unlock()
+	listening = true
+}
+
+// completeListeners returns the open listeners, false until listening is
+// complete, as a new process would not get the listeners opened later
+func completeListeners() ([]namedListener, bool) {
+	openListenersMtx.Lock()
+	defer openListenersMtx.Unlock()
+	return append([]namedListener{}, openListeners...), listening
+}
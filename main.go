@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"sync"
+	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/larseen/emq_exporter/pkg/mqtt"
+	"github.com/larseen/emq_exporter/pkg/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
@@ -12,45 +24,504 @@ import (
 )
 
 var (
-	listenAddress = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface.").Default(":9444").String()
-	metricsPath   = kingpin.Flag("web.telemetry-path", "Path under which to expose Prometheus metrics.").Default("/metrics").String()
-	emqURL        = kingpin.Flag("emq.uri", "HTTP API address of the EMQ node.").Default("http://127.0.0.1:8080").URL()
-	emqUsername   = kingpin.Flag("emq.username", "EMQ username.").Default("admin").String()
-	emqPassword   = kingpin.Flag("emq.password", "EMQ password.").Default("public").String()
-	emqNodeName   = kingpin.Flag("emq.node", "Node name of the emq node to scrape.").Default("emq@127.0.0.1").String()
+	listenAddresses       = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface, repeatable, e.g. for an IPv4 and an IPv6 address.").Default(":9444").Strings()
+	allowNodeParam        = kingpin.Flag("web.allow-node-parameter", "Allow the node URL parameter of the metrics endpoint, which scrapes another node of the cluster of the target for ad-hoc debugging.").Default("false").Bool()
+	systemdSocket         = kingpin.Flag("web.systemd-socket", "Serve the metrics and web interface on the sockets passed by systemd socket activation in place of web.listen-address.").Default("false").Bool()
+	enableUpgrade         = kingpin.Flag("web.enable-upgrade", "Start the exporter binary again on SIGUSR2, handing the listeners over to the new process without closing them, and exit once it is ready.").Default("false").Bool()
+	internalListenAddress = kingpin.Flag("web.internal-listen-address", "Address on which to expose the health, debug and lifecycle endpoints, the web.listen-address if empty.").Default("").String()
+	maxScrapes            = kingpin.Flag("web.max-concurrent-scrapes", "Maximum number of concurrent scrapes, further scrapes are answered with 503. 0 means no limit.").Default("0").Int()
+	metricsPath           = kingpin.Flag("web.telemetry-path", "Path under which to expose Prometheus metrics.").Default("/metrics").String()
+	exposition            = kingpin.Flag("web.exposition-format", "Exposition format of the metrics, negotiated with the scraper by default.").Default("auto").Enum("auto", "text", "protobuf")
+	disableCompression    = kingpin.Flag("web.disable-compression", "Never gzip the metrics, which are otherwise compressed for scrapers accepting gzip.").Default("false").Bool()
+	scrapeDurationWindow  = kingpin.Flag("web.scrape-duration-window", "Rolling window of the quantiles of emq_exporter_scrape_duration_seconds.").Default("10m").Duration()
+	timeoutOffset         = kingpin.Flag("web.scrape-timeout-offset", "Offset subtracted from the scrape timeout announced by Prometheus to get the deadline of the EMQ API requests.").Default("500ms").Duration()
+	minScrapeInterval     = kingpin.Flag("web.min-scrape-interval", "Minimum time between two scrapes of the EMQ node, faster scrapes are served the previous result (0 disables).").Default("0s").Duration()
+	emqURL                = kingpin.Flag("emq.uri", "HTTP API address of the EMQ node, IPv6 addresses must be enclosed in brackets (e.g. http://[::1]:8080).").Default("http://127.0.0.1:8080").String()
+	emqFallbackURL        = kingpin.Flag("emq.fallback-uri", "HTTP API address requested when the one of --emq.uri fails, e.g. the dashboard of another node of the cluster.").Default("").String()
+	emqSOCKS5Proxy        = kingpin.Flag("emq.socks5-proxy", "SOCKS5 proxy the EMQ API is reached through, as host:port or user:password@host:port.").Default("").String()
+	emqSSHHost            = kingpin.Flag("emq.ssh.host", "SSH host, as host or host:port, the EMQ API port is forwarded through, disabled if empty.").Default("").String()
+	emqSSHUser            = kingpin.Flag("emq.ssh.user", "User logging in to the SSH host.").Default("").String()
+	emqSSHKeyFile         = kingpin.Flag("emq.ssh.key-file", "Private key authenticating against the SSH host, next to the keys of the SSH agent.").Default("").String()
+	emqSSHKnownHostsFile  = kingpin.Flag("emq.ssh.known-hosts-file", "Known hosts file verifying the key of the SSH host, ~/.ssh/known_hosts if empty.").Default("").String()
+	emqServerFingerprint  = kingpin.Flag("emq.tls.server-fingerprint", "SHA256 fingerprint of the certificate of the EMQ API, in hex, which is trusted in place of the CAs.").Default("").String()
+	capabilityInterval    = kingpin.Flag("emq.capability-check-interval", "Interval at which the optional endpoints a node answered with 404 are requested again.").Default("1h").Duration()
+	maxParallelNodes      = kingpin.Flag("emq.max-parallel-nodes", "Maximum number of targets scraped in parallel (0 means all at once).").Default("10").Int()
+	staleCacheFile        = kingpin.Flag("emq.stale-cache-file", "File persisting the last good scrape, which is served while the EMQ node is unreachable. Disabled if empty.").Default("").String()
+	staleMaxAge           = kingpin.Flag("emq.stale-max-age", "Maximum age of the last good scrape served from the stale cache.").Default("5m").Duration()
+	emqDNSCacheTTL        = kingpin.Flag("emq.dns-cache-ttl", "How long the resolved addresses of the EMQ hostnames are cached, in place of the TTL of the DNS records. The cached addresses are used while lookups fail (0 disables caching).").Default("0s").Duration()
+	emqStrictDecode       = kingpin.Flag("emq.strict-decode", "Fail the scrape when an EMQ API response holds fields the exporter does not map, and count them, to surface changes of the API. The node is reported down while its nodes, metrics, stats or management responses hold unknown fields.").Default("false").Bool()
+	emqAPIBasePath        = kingpin.Flag("emq.api-base-path", "Path prefix of the EMQ HTTP API, e.g. when it is served behind a reverse proxy.").Default("").String()
+	emqUsername           = kingpin.Flag("emq.username", "EMQ username.").Default("admin").String()
+	emqPassword           = kingpin.Flag("emq.password", "EMQ password.").Default("public").String()
+	emqNodeName           = kingpin.Flag("emq.node", "Node name of the emq node to scrape.").Default("emq@127.0.0.1").String()
+	emqNodeFallback       = kingpin.Flag("emq.node-fallback", "Use the only node of the management endpoint for the version label when none matches emq.node.").Default("false").Bool()
+	emqMemoryBase         = kingpin.Flag("emq.memory-unit-base", "Whether memory units reported by EMQ without an explicit \"i\" (e.g. 512.00M) are binary (1024) or decimal (1000).").Default("binary").Enum("binary", "decimal")
+	emqAuthMode           = kingpin.Flag("emq.auth-mode", "How to authenticate against the EMQ API: basic auth or a dashboard session token obtained by logging in.").Default(emqapi.AuthModeBasic).Enum(emqapi.AuthModeBasic, emqapi.AuthModeToken)
+	emqAPIVersion         = kingpin.Flag("emq.api-version", "Version of the EMQ HTTP API (v2, v3, v4), detected automatically if empty.").Default("").String()
+	responseSizeWarning   = kingpin.Flag("emq.response-size-warning", "Log a warning when an EMQ API response is larger than this many bytes (0 disables).").Default("0").Int64()
+	enableLifecycle       = kingpin.Flag("web.enable-lifecycle", "Enable the /-/reload and /-/quit endpoints.").Default("false").Bool()
+	lifecycleToken        = kingpin.Flag("web.lifecycle-token", "Bearer token required by the lifecycle endpoints, required with --web.enable-lifecycle.").Default("").String()
+	tracingEndpoint       = kingpin.Flag("tracing.endpoint", "OTLP/HTTP endpoint to export scrape traces to, tracing is disabled if empty.").Default("").String()
+	grpcListenAddress     = kingpin.Flag("grpc.listen-address", "Address on which to expose the gRPC metrics snapshot service, disabled if empty.").Default("").String()
+	grpcTLSCertFile       = kingpin.Flag("grpc.tls-cert-file", "TLS certificate of the gRPC service, gRPC requires HTTP/2 over TLS.").Default("").String()
+	grpcTLSKeyFile        = kingpin.Flag("grpc.tls-key-file", "TLS key of the gRPC service.").Default("").String()
+	legacyNames           = kingpin.Flag("metrics.legacy-names", "Serve the metric names used before unit suffixes were added, with the packet and message counters as gauges.").Default("false").Bool()
+	labeledFamilies       = kingpin.Flag("metrics.labeled-families", "Merge the sent and received counters into families with a direction label, and the message counters of the QoS levels into one with a qos label, e.g. emq_metric_bytes_total and emq_metric_messages_total.").Default("false").Bool()
+	compatWindow          = kingpin.Flag("metrics.compat-window", "How long after the build date of the exporter the old names of renamed metrics are served next to the current ones (0 disables).").Default("0s").Duration()
+	clusterNodeLabels     = kingpin.Flag("metrics.cluster-node-labels", "Keep the node and version labels of the scraped node on cluster metrics like emq_cluster_size, as served by earlier releases.").Default("false").Bool()
+	brokerTimestamps      = kingpin.Flag("metrics.broker-timestamps", "Timestamp the samples of the nodes with the datetime reported by the brokers.").Default("false").Bool()
+	versionLabel          = kingpin.Flag("metric.include-exporter-version-label", "Add the version of the exporter as exporter_version label to the EMQ metrics.").Default("false").Bool()
+	license               = kingpin.Flag("metrics.license", "Export the license expiry and connection limit of EMQ X Enterprise brokers.").Default("false").Bool()
+	clientSubscriptions   = kingpin.Flag("metrics.client-subscriptions", "Page through the clients of the nodes on every scrape and export a histogram of their subscription counts.").Default("false").Bool()
+	offlineSessions       = kingpin.Flag("metrics.offline-sessions", "Page through the clients of the nodes on every scrape and export the persistent sessions of disconnected clients and their queued messages.").Default("false").Bool()
+	topClients            = kingpin.Flag("metrics.top-clients", "Page through the clients of the nodes on every scrape and export the traffic of this many clients receiving and sending the most bytes (0 disables).").Default("0").Int()
+	exhooks               = kingpin.Flag("metrics.exhooks", "Export the status and hook invocation counters of the exhook gRPC servers of the EMQ nodes.").Default("false").Bool()
+	gateways              = kingpin.Flag("metrics.gateways", "Export the clients and message counters of the multi-protocol gateways, e.g. CoAP, LwM2M, MQTT-SN and STOMP.").Default("false").Bool()
+	congestion            = kingpin.Flag("metrics.congestion", "Export the slow subscribers and the connections with a congestion alarm of the EMQ nodes.").Default("false").Bool()
+	listeners             = kingpin.Flag("metrics.listeners", "Export the connections, connection limits and shutdown reasons of the protocol listeners of the EMQ nodes.").Default("false").Bool()
+	compensateResets      = kingpin.Flag("metrics.compensate-counter-resets", "Keep the counters of the EMQ nodes rising across broker restarts by adding their values before the restart, e.g. for push backends which take a reset for a negative increase.").Default("false").Bool()
+	routeDivergence       = kingpin.Flag("cluster.route-divergence", "Number of routes the route counts of the targets may differ by before emq_cluster_route_table_inconsistent is set (negative disables).").Default("0").Int()
+	sysURL                = kingpin.Flag("sys.uri", "MQTT address of an EMQ node to subscribe to the $SYS topics of, e.g. tcp://127.0.0.1:1883 or ws://127.0.0.1:8083/mqtt, disabled if empty.").Default("").String()
+	sysUsername           = kingpin.Flag("sys.username", "Username of the MQTT connection, which must be allowed to subscribe to $SYS/#.").Default("").String()
+	sysPassword           = kingpin.Flag("sys.password", "Password of the MQTT connection.").Default("").String()
+	sysClientID           = kingpin.Flag("sys.client-id", "Client ID of the MQTT connection, assigned by the broker if empty.").Default("").String()
+	sysKeepAlive          = kingpin.Flag("sys.keep-alive", "Keep alive interval of the MQTT connection, in whole seconds up to 18h12m15s.").Default("30s").Duration()
+	sysPayloadSizeFilters = kingpin.Flag("sys.payload-size-filter", "Topic filter of application messages whose payload sizes are observed, e.g. $share/emq_exporter/devices/#. Can be repeated.").Strings()
+	sysExpiry             = kingpin.Flag("sys.expiry", "How long the $SYS values of a node are served after its last message.").Default("5m").Duration()
+	haLockFile            = kingpin.Flag("ha.lock-file", "Lock file shared by the replicas of the exporter, only the replica holding it pushes and subscribes to $SYS, disabled if empty.").Default("").String()
+	haLease               = kingpin.Flag("ha.lease", "Kubernetes Lease, as name or namespace/name, held by the replica which pushes and subscribes to $SYS, disabled if empty.").Default("").String()
+	haIdentity            = kingpin.Flag("ha.identity", "Identity of the replica holding the lease, the hostname if empty.").Default("").String()
+	haLeaseDuration       = kingpin.Flag("ha.lease-duration", "How long a lease not renewed by the leader is kept before a standby replica takes over.").Default("15s").Duration()
+	haRetryPeriod         = kingpin.Flag("ha.retry-period", "Interval at which the leader renews the lock and the standby replicas try to acquire it.").Default("5s").Duration()
+	errorLogEvery         = kingpin.Flag("log.error-every", "Log only the first and every Nth repetition of the same scrape error, and its recovery (1 logs every error).").Default("10").Int()
+	debugFailEndpoints    = kingpin.Flag("debug.fail-endpoint", "Fail the requests to this EMQ API endpoint, e.g. metrics, to test alerting. Can be repeated.").Hidden().Strings()
+	debugDumpResponses    = kingpin.Flag("debug.dump-responses", "Write every EMQ API response to a timestamped file in this directory, with secrets redacted, disabled if empty.").Default("").String()
+	debugLatency          = kingpin.Flag("debug.latency", "Delay every EMQ API request by this long, to test alerting.").Hidden().Default("0s").Duration()
+	pushURL               = kingpin.Flag("push.url", "URL of a Pushgateway to push the metrics to, pushing is disabled if empty.").Default("").String()
+	pushRemoteWriteURL    = kingpin.Flag("push.remote-write-url", "URL of a Prometheus remote write endpoint, e.g. of Cortex, Mimir or Grafana Cloud, to push the metrics to, disabled if empty.").Default("").String()
+	pushInterval          = kingpin.Flag("push.interval", "Interval between two pushes to the Pushgateway or the remote write endpoint.").Default("15s").Duration()
+	pushJob               = kingpin.Flag("push.job", "Job name of the pushed metrics.").Default("emq_exporter").String()
+	pushOnlyChanged       = kingpin.Flag("push.only-changed", "Only push the metric families whose samples changed since the last push, to the Pushgateway and the remote write endpoint.").Default("false").Bool()
+	pushFullEvery         = kingpin.Flag("push.full-every", "With push.only-changed, push every metric family every this many pushes, so a restarted Pushgateway gets the unchanged ones back and remote written series do not go stale (0 disables).").Default("20").Int()
+	pushUsername          = kingpin.Flag("push.username", "Username for basic auth against the push endpoint.").Default("").String()
+	pushPassword          = kingpin.Flag("push.password", "Password for basic auth against the push endpoint.").Default("").String()
+	pushBearerToken       = kingpin.Flag("push.bearer-token", "Bearer token sent to the push endpoint, takes precedence over basic auth.").Default("").String()
+	pushTenantID          = kingpin.Flag("push.tenant-id", "Tenant sent in the X-Scope-OrgID header, for Cortex, Mimir and Grafana Cloud.").Default("").String()
+	once                  = kingpin.Flag("once", "Collect the metrics once, print them to stdout and exit with a non-zero status if any node could not be scraped.").Default("false").Bool()
+	configFile            = kingpin.Flag("config.file", "Path to the exporter configuration file.").Default("").String()
+
+	_              = kingpin.Command("serve", "Run the exporter (default).").Default()
+	listMetricsCmd = kingpin.Command("list-metrics", "Print every metric the current configuration would emit, without contacting the EMQ node.")
+
+	benchCmd      = kingpin.Command("bench", "Measure scrape throughput, allocations and latency against a mock broker.")
+	benchTargetsN = benchCmd.Flag("targets", "Number of targets scraped by the benchmark.").Default("10").Int()
+	benchDuration = benchCmd.Flag("duration", "How long every collector configuration is benchmarked.").Default("10s").Duration()
+
+	generateCmd         = kingpin.Command("generate", "Generate configuration for other tools.")
+	scrapeConfigCmd     = generateCmd.Command("scrape-config", "Print a Prometheus scrape config for the configured targets.")
+	scrapeConfigTargets = scrapeConfigCmd.Flag("targets", "Comma separated names of the targets to include in probe mode, all configured targets if empty.").Default("").String()
+	scrapeConfigProbe   = scrapeConfigCmd.Flag("probe", "Scrape every target separately through the target URL parameter of the metrics endpoint.").Default("false").Bool()
+	scrapeConfigAddress = scrapeConfigCmd.Flag("exporter-address", "Address Prometheus reaches the exporter on, derived from --web.listen-address if empty.").Default("").String()
+	scrapeConfigFileSD  = scrapeConfigCmd.Flag("file-sd", "Write the targets to this file_sd file and reference it from the scrape config.").Default("").String()
 )
 
+// buildInfoName is the name of the metric of version.NewCollector
+const buildInfoName = "emq_exporter_build_info"
+
 func init() {
 	prometheus.MustRegister(version.NewCollector("emq_exporter"))
+	prometheus.MustRegister(rejectedScrapes)
+	prometheus.MustRegister(configLastReloadSuccessful, configLastReloadTime)
+}
+
+// buildTime returns the build date of the exporter, or the current time for
+// builds without one
+func buildTime() time.Time {
+	t, err := time.Parse("20060102-15:04:05", version.BuildDate)
+	if err != nil {
+		return time.Now()
+	}
+	return t
 }
 
 func main() {
 	log.AddFlags(kingpin.CommandLine)
 	kingpin.Version(version.Print("emq_exporter"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
+	prometheus.MustRegister(newFlagsInfo(kingpin.CommandLine))
+
+	cfg, err := config.Load(*configFile, builtinMetricNames())
+	if err != nil {
+		log.Fatal(err)
+	}
+	recordReload(nil)
+
+	if command == scrapeConfigCmd.FullCommand() {
+		address := *scrapeConfigAddress
+		if address == "" {
+			address = exporterAddress((*listenAddresses)[0])
+		}
+		sc, err := newScrapeConfig(cfg, *scrapeConfigTargets, address, *scrapeConfigProbe)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sc.FileSD = *scrapeConfigFileSD
+		if err := writeScrapeConfig(os.Stdout, sc); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var api *emqapi.APIVersion
+	if *emqAPIVersion != "" {
+		api, err = emqapi.FindAPIVersion(*emqAPIVersion)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var tracer *tracing.Tracer
+	if *tracingEndpoint != "" {
+		tracer, err = tracing.NewTracer(*tracingEndpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	defaults := config.TargetConfig{
+		URI:         *emqURL,
+		FallbackURI: *emqFallbackURL,
+		Node:        *emqNodeName,
+		Username:    *emqUsername,
+		Password:    *emqPassword,
+		SOCKS5Proxy: *emqSOCKS5Proxy,
+		TLS:         config.TLSConfig{ServerFingerprint: *emqServerFingerprint},
+		SSH: config.SSHConfig{
+			Host:           *emqSSHHost,
+			User:           *emqSSHUser,
+			KeyFile:        *emqSSHKeyFile,
+			KnownHostsFile: *emqSSHKnownHostsFile,
+		},
+	}
+	memoryUnitBase := float64(emqapi.BinaryUnitBase)
+	if *emqMemoryBase == "decimal" {
+		memoryUnitBase = emqapi.DecimalUnitBase
+	}
+
+	opts := collector.Options{
+		MinScrapeInterval:          *minScrapeInterval,
+		MemoryUnitBase:             memoryUnitBase,
+		Tracer:                     tracer,
+		LegacyNames:                *legacyNames,
+		LabeledFamilies:            *labeledFamilies,
+		BrokerTimestamps:           *brokerTimestamps,
+		ResponseSizeWarning:        *responseSizeWarning,
+		License:                    *license,
+		ClientSubscriptions:        *clientSubscriptions,
+		OfflineSessions:            *offlineSessions,
+		TopClients:                 *topClients,
+		Exhooks:                    *exhooks,
+		Gateways:                   *gateways,
+		Congestion:                 *congestion,
+		Listeners:                  *listeners,
+		CompensateCounterResets:    *compensateResets,
+		ScrapeDurationWindow:       *scrapeDurationWindow,
+		CapabilityInterval:         *capabilityInterval,
+		StaleCacheFile:             *staleCacheFile,
+		StaleMaxAge:                *staleMaxAge,
+		ErrorLogEvery:              *errorLogEvery,
+		NodeLabelsOnClusterMetrics: *clusterNodeLabels,
+		NodeNameFallback:           *emqNodeFallback,
+	}
+	if *legacyNames && *labeledFamilies {
+		log.Fatal("--metrics.legacy-names and --metrics.labeled-families cannot be combined")
+	}
+	if *compatWindow > 0 {
+		opts.CompatUntil = buildTime().Add(*compatWindow)
+	}
+	clientOpts := emqapi.Options{
+		AuthMode:      *emqAuthMode,
+		APIBasePath:   *emqAPIBasePath,
+		DNSCacheTTL:   *emqDNSCacheTTL,
+		StrictDecode:  *emqStrictDecode,
+		FailEndpoints: *debugFailEndpoints,
+		Latency:       *debugLatency,
+	}
+	if len(*debugFailEndpoints) > 0 || *debugLatency > 0 {
+		log.Warnf("Injecting failures of the %v endpoints and %s of latency into the EMQ API requests", *debugFailEndpoints, *debugLatency)
+	}
+	if *debugDumpResponses != "" {
+		if err := os.MkdirAll(*debugDumpResponses, 0700); err != nil {
+			log.Fatal(err)
+		}
+		log.Warnf("Dumping the EMQ API responses to %s", *debugDumpResponses)
+		dumper := &responseDumper{dir: *debugDumpResponses}
+		clientOpts.DumpResponse = dumper.dump
+	}
+	build := func(cfg *config.Config) (*targetSet, error) {
+		set, err := buildTargets(cfg, defaults, api, opts, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+		// the tunnels of the targets removed from the configuration
+		closeUnusedSSHTunnels(set)
+		set.routeDivergence = *routeDivergence
+		set.maxParallel = *maxParallelNodes
+		if *versionLabel {
+			set.exporterVersion = version.Version
+		}
+		return set, nil
+	}
+
+	if command == benchCmd.FullCommand() {
+		if err := runBench(os.Stdout, *benchTargetsN, *benchDuration); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if command == listMetricsCmd.FullCommand() {
+		// the collector is only described, so neither the targets nor their
+		// SSH tunnels are set up
+		u, err := emqapi.ParseURL(*emqURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		emq := emqapi.New(http.DefaultClient, u, *emqNodeName, "", "", api, clientOpts)
+		if err := collector.ListMetrics(os.Stdout, collector.New(emq, cfg, opts)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	set, err := build(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	targets := &targetsGatherer{set: set}
+
+	if *once {
+		if err := collectOnce(os.Stdout, targets); err != nil {
+			log.Errorln(err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	log.Infoln("Starting emq_exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
 
-	httpClient := &http.Client{}
-	nodeName := *emqNodeName
-	username := *emqUsername
-	password := *emqPassword
-	prometheus.MustRegister(NewEMQCollector(httpClient, emqURL, nodeName, username, password))
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+
+	if err := inheritListeners(); err != nil {
+		log.Fatal(err)
+	}
+	if *enableUpgrade {
+		handleUpgrades(func() { quitOnce.Do(func() { close(quit) }) })
+	}
+
+	elector, err := newElector()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	base := prometheus.Gatherers{prometheus.DefaultGatherer}
+	if *sysURL != "" {
+		u, err := url.Parse(*sysURL)
+		if err != nil || u.Host == "" {
+			log.Fatalf("Invalid --sys.uri %q", *sysURL)
+		}
+		sys, err := collector.NewSysSource(u, collector.SysOptions{
+			Options: mqtt.Options{
+				ClientID:    *sysClientID,
+				Username:    *sysUsername,
+				Password:    *sysPassword,
+				KeepAlive:   *sysKeepAlive,
+				DialTimeout: 10 * time.Second,
+			},
+			Expiry:             *sysExpiry,
+			Mappings:           cfg.SysMappings,
+			PayloadSizeFilters: *sysPayloadSizeFilters,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if elector == nil {
+			go sys.Run(context.Background())
+		} else {
+			// only the leader subscribes, so every event is counted once
+			var cancel context.CancelFunc
+			elector.Watch(func(leading bool) {
+				if leading {
+					var ctx context.Context
+					ctx, cancel = context.WithCancel(context.Background())
+					go sys.Run(ctx)
+				} else if cancel != nil {
+					cancel()
+				}
+			})
+		}
+		base = append(base, sys)
+	}
+
+	// the errors of failing targets are logged, the others are still served
+	handlerOpts := promhttp.HandlerOpts{
+		DisableCompression: *disableCompression,
+		ErrorLog:           promLogger{},
+		ErrorHandling:      promhttp.ContinueOnError,
+	}
+	mux := http.NewServeMux()
+	mux.Handle(*metricsPath, limitConcurrency(*maxScrapes, forceFormat(*exposition, scrapeDeadlineHandler(base, targets, *timeoutOffset, *allowNodeParam, handlerOpts))))
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	// the health, debug and lifecycle endpoints are served on their own
+	// listener if one is configured
+	internalMux := mux
+	if *internalListenAddress != "" {
+		internalMux = http.NewServeMux()
+	}
+	internalMux.HandleFunc("/targets", targetsHandler(targets))
+	internalMux.HandleFunc("/-/ready", readyHandler(targets))
+	internalMux.HandleFunc("/debug/pprof/", pprof.Index)
+	internalMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	internalMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	internalMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	internalMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	auth := pushAuth{
+		Username:    *pushUsername,
+		Password:    *pushPassword,
+		BearerToken: *pushBearerToken,
+		TenantID:    *pushTenantID,
+	}
+	var pushers []*pusher
+	if *pushURL != "" {
+		pushers = append(pushers, newPusher(*pushURL, *pushJob, targets, base, *pushOnlyChanged, *pushFullEvery, auth))
+	}
+	if *pushRemoteWriteURL != "" {
+		pushers = append(pushers, newRemoteWriter(*pushRemoteWriteURL, *pushJob, targets, base, *pushOnlyChanged, *pushFullEvery, auth))
+	}
+	for _, p := range pushers {
+		if elector != nil {
+			p.leading = elector.Leading
+		}
+		go p.run(*pushInterval, quit)
+	}
+
+	if elector != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			elector.Run(ctx)
+			close(done)
+		}()
+		// release the lock on shutdown, so a standby replica takes over
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if *grpcListenAddress != "" {
+		if *grpcTLSCertFile == "" || *grpcTLSKeyFile == "" {
+			log.Fatal("The gRPC service requires --grpc.tls-cert-file and --grpc.tls-key-file")
+		}
+		grpcListeners, err := listen("grpc", []string{*grpcListenAddress}, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			log.Infoln("Listening for gRPC on", *grpcListenAddress)
+			err := http.ServeTLS(grpcListeners[0], grpcHandler(targets, base), *grpcTLSCertFile, *grpcTLSKeyFile)
+			log.Fatal(err)
+		}()
+	}
+
+	if *enableLifecycle {
+		// the lifecycle endpoints may be served on the public listener
+		if *lifecycleToken == "" {
+			log.Fatal("--web.enable-lifecycle requires --web.lifecycle-token")
+		}
+		r := &reloader{
+			filename: *configFile,
+			targets:  targets,
+			build:    build,
+		}
+		internalMux.HandleFunc("/-/reload", lifecycleHandler(*lifecycleToken, r.handleReload))
+		internalMux.HandleFunc("/-/quit", lifecycleHandler(*lifecycleToken, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			quitOnce.Do(func() { close(quit) })
+		}))
+	}
+
+	targetsLink := `
+    <p><a href="/targets">Targets</a></p>`
+	if *internalListenAddress != "" {
+		targetsLink = ""
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
     <head><title>EMQ Exporter</title></head>
     <body>
     <h1>EMQ Exporter</h1>
-    <p><a href="` + *metricsPath + `">Metrics</a></p>
+    <p><a href="` + *metricsPath + `">Metrics</a></p>` + targetsLink + `
     </body>
     </html>`))
 	})
 
-	log.Infoln("Listening on", *listenAddress)
-	http.ListenAndServe(*listenAddress, nil)
+	webListeners, err := listen("web", *listenAddresses, *systemdSocket)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: mux}
+	servers := []*http.Server{srv}
+	if *internalListenAddress != "" {
+		internalListeners, err := listen("internal", []string{*internalListenAddress}, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		internal := &http.Server{Handler: internalMux}
+		servers = append(servers, internal)
+		go func() {
+			log.Infoln("Listening for internal endpoints on", *internalListenAddress)
+			if err := internal.Serve(internalListeners[0]); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// Serve returns as soon as the shutdown starts, main waits for the
+	// in-flight requests of all servers to be answered before exiting
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-quit
+		log.Infoln("Shutting down gracefully")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, s := range servers {
+			if err := s.Shutdown(ctx); err != nil {
+				log.Errorf("Error during shutdown: %s", err)
+			}
+		}
+	}()
+
+	errs := make(chan error, len(webListeners))
+	for _, l := range webListeners {
+		log.Infoln("Listening on", l.Addr())
+		go func(l net.Listener) {
+			errs <- srv.Serve(l)
+		}(l)
+	}
+	listeningComplete()
+	upgradeReady()
+	for range webListeners {
+		if err := <-errs; err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}
+	<-shutdownDone
 }
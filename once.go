@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// collectOnce writes the metrics of a single collection to w in the text
+// format and returns an error if gathering failed or any node is down
+func collectOnce(w io.Writer, gatherer prometheus.Gatherer) error {
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	upName := prometheus.BuildFQName(collector.Namespace, "node", "up")
+	down := 0
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+		if mf.GetName() != upName {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetGauge().GetValue() != 1 {
+				down++
+			}
+		}
+	}
+
+	if down > 0 {
+		return fmt.Errorf("%d EMQ node(s) could not be scraped", down)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// BrokersFetcher is implemented by the fetchers able to fetch the brokers
+// endpoint of the node
+type BrokersFetcher interface {
+	Brokers(ctx context.Context) (emqapi.BrokersResponse, error)
+}
+
+var _ BrokersFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	brokerInfoDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "broker", "info"),
+		"Description of the EMQ broker, the value is always 1.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "sysdescr"}, nil,
+	)
+	brokerUptimeDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "broker", "uptime_seconds"),
+		"Time since the EMQ broker started, in seconds.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+	brokerTimeDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "broker", "time_seconds"),
+		"Datetime reported by the EMQ broker, in seconds since the epoch.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+)
+
+// uptimePart matches a part of the uptime reported by the broker, e.g.
+// "1 days,18 hours, 45 minutes, 1 seconds"
+var uptimePart = regexp.MustCompile(`(\d+)\s*(day|hour|minute|second)s?`)
+
+var uptimeUnits = map[string]time.Duration{
+	"day":    24 * time.Hour,
+	"hour":   time.Hour,
+	"minute": time.Minute,
+	"second": time.Second,
+}
+
+// parseUptime parses the uptime reported by the broker
+func parseUptime(s string) (time.Duration, error) {
+	parts := uptimePart.FindAllStringSubmatch(s, -1)
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("invalid uptime %q", s)
+	}
+	var uptime time.Duration
+	for _, p := range parts {
+		n, err := strconv.Atoi(p[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid uptime %q: %s", s, err)
+		}
+		uptime += time.Duration(n) * uptimeUnits[p[2]]
+	}
+	return uptime, nil
+}
+
+// collectBrokers sends the description, uptime and datetime of the broker,
+// failures are logged without marking the node as down
+func (c *Collector) collectBrokers(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(BrokersFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("brokers") {
+		return
+	}
+	brokers, err := fetcher.Brokers(ctx)
+	c.caps.record("brokers", err)
+	if err != nil {
+		c.optionalError(logger, err)
+		return
+	}
+	if brokers.Code != 0 {
+		c.recordAPIError(logger, "brokers", brokers.Code)
+		return
+	}
+	c.markSuccess("brokers")
+
+	broker := brokers.Result
+	ch <- prometheus.MustNewConstMetric(
+		brokerInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		c.client.Node(),
+		broker.Version,
+		broker.Sysdescr,
+	)
+
+	if uptime, err := parseUptime(broker.Uptime); err != nil {
+		logger.Debug(err)
+	} else {
+		ch <- &snapshotMetric{
+			desc:      brokerUptimeDesc,
+			valueType: prometheus.GaugeValue,
+			value:     uptime.Seconds(),
+			labels:    labels,
+		}
+	}
+
+	if datetime, err := parseBrokerTime(broker.Datetime); err != nil {
+		logger.Debugf("Cannot parse the datetime %q of the broker: %s", broker.Datetime, err)
+	} else {
+		ch <- &snapshotMetric{
+			desc:      brokerTimeDesc,
+			valueType: prometheus.GaugeValue,
+			value:     float64(datetime.Unix()),
+			labels:    labels,
+		}
+	}
+}
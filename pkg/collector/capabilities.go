@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/common/log"
+)
+
+// defaultCapabilityInterval is the interval of the capability checks if
+// none is configured
+const defaultCapabilityInterval = time.Hour
+
+// capabilities tracks which optional endpoints the node serves, like the
+// brokers, license, clients, exhooks, gateways, slow subscriptions, alarms,
+// listeners, topic metrics and custom endpoints. Endpoints the node answered
+// with 404 are skipped until the next check. It is only used by scrapes,
+// which never run concurrently.
+type capabilities struct {
+	checked     time.Time
+	checking    bool
+	supported   map[string]bool
+	unsupported map[string]bool
+}
+
+// begin starts a new check at the first scrape after the interval, during
+// which every optional endpoint is requested again
+func (caps *capabilities) begin(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCapabilityInterval
+	}
+	if time.Since(caps.checked) < interval {
+		return
+	}
+	caps.checked = time.Now()
+	caps.checking = true
+	caps.supported = make(map[string]bool)
+	caps.unsupported = make(map[string]bool)
+}
+
+// enabled reports whether the endpoint should be requested
+func (caps *capabilities) enabled(endpoint string) bool {
+	return !caps.unsupported[endpoint]
+}
+
+// record marks the endpoint as unsupported if the request failed with 404
+func (caps *capabilities) record(endpoint string, err error) {
+	if _, ok := err.(*emqapi.NotFoundError); ok {
+		caps.unsupported[endpoint] = true
+		return
+	}
+	if err == nil {
+		caps.supported[endpoint] = true
+	}
+}
+
+// end logs the outcome of a check at the end of its scrape
+func (caps *capabilities) end(logger log.Logger, node, api string) {
+	if !caps.checking {
+		return
+	}
+	caps.checking = false
+	logger.Infof("EMQ node %s speaks API %s, supported endpoints: %s, unsupported endpoints: %s",
+		node, api, endpointList(caps.supported), endpointList(caps.unsupported))
+}
+
+func endpointList(endpoints map[string]bool) string {
+	if len(endpoints) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// optionalError logs a failed request to an optional endpoint, endpoints
+// the node does not serve are only reported by the capability check
+func (c *Collector) optionalError(logger log.Logger, err error) {
+	if _, ok := err.(*emqapi.NotFoundError); ok {
+		logger.Debug(err)
+		return
+	}
+	c.errorLog.Error(logger, err)
+}
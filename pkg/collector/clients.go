@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// ClientsFetcher is implemented by the fetchers able to page through the
+// MQTT clients connected to the node
+type ClientsFetcher interface {
+	Clients(ctx context.Context, page, limit int) (emqapi.ClientsResponse, error)
+}
+
+var _ ClientsFetcher = (*emqapi.HTTPClient)(nil)
+
+const (
+	// clientsPageSize is the number of clients requested per page
+	clientsPageSize = 1000
+	// maxClientsPages bounds the requests of a scrape, the clients of
+	// further pages are left out of the client metrics
+	maxClientsPages = 1000
+)
+
+// subscriptionBuckets are the upper bounds of the buckets of the
+// subscriptions per client
+var subscriptionBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000}
+
+var (
+	clientSubscriptionsDesc = packageInfos.newHistogramDesc(
+		prometheus.BuildFQName(Namespace, "client", "subscriptions"),
+		"Number of subscriptions per MQTT client connected to the EMQ node.",
+		defaultLabels, nil,
+	)
+	offlineSessionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "session", "offline"),
+		"Number of persistent sessions of disconnected clients on the EMQ node.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+	offlineQueuedMessagesDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "session", "offline_queued_messages"),
+		"Number of messages queued for disconnected clients in the persistent sessions on the EMQ node.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+	tenantConnectionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "tenant", "connections"),
+		"Number of connected MQTT clients of the tenant on the EMQ node.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "tenant"}, nil,
+	)
+	topClientBytesDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "client", "bytes_total"),
+		"Number of bytes received from or sent to the MQTT clients of the EMQ node with the most traffic in the direction, since they connected.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "clientid", "direction"}, nil,
+	)
+	tenantSubscriptionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "tenant", "subscriptions"),
+		"Number of subscriptions of the MQTT clients of the tenant on the EMQ node.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "tenant"}, nil,
+	)
+)
+
+// tenantCounts are the client metrics of a tenant
+type tenantCounts struct {
+	connections   float64
+	subscriptions float64
+}
+
+// tenant returns the tenant of a client, empty if its client ID or username
+// does not match the tenant regex
+func (c *Collector) tenant(client emqapi.ClientInfo) string {
+	value := client.ClientID
+	if c.tenantByUsername {
+		value = client.Username
+	}
+	if m := c.tenantRE.FindStringSubmatch(value); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// collectClients pages through the clients of the node and sends the
+// histogram of their subscription counts, the sessions and queued messages
+// of the disconnected clients, the connections and subscriptions by tenant
+// and the traffic of the top clients, failures are logged without marking
+// the node as down
+func (c *Collector) collectClients(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labelValues ...string) {
+	fetcher, ok := c.client.(ClientsFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("clients") {
+		return
+	}
+
+	var count, offline uint64
+	var sum, queued float64
+	buckets := make(map[float64]uint64, len(subscriptionBuckets))
+	tenants := make(map[string]*tenantCounts)
+	received := &topClients{n: c.opts.TopClients}
+	sent := &topClients{n: c.opts.TopClients}
+	for page := 1; page <= maxClientsPages; page++ {
+		clients, err := fetcher.Clients(ctx, page, clientsPageSize)
+		if page == 1 {
+			c.caps.record("clients", err)
+		}
+		if err != nil {
+			c.optionalError(logger, err)
+			return
+		}
+		if clients.Code != 0 {
+			c.recordAPIError(logger, "clients", clients.Code)
+			return
+		}
+
+		for _, client := range clients.Result {
+			n := float64(client.SubscriptionsCount)
+			count++
+			sum += n
+			for _, bound := range subscriptionBuckets {
+				if n <= bound {
+					buckets[bound]++
+				}
+			}
+			if !client.Connected {
+				offline++
+				queued += float64(client.MqueueLen)
+			}
+			if c.tenantRE != nil {
+				name := c.tenant(client)
+				t, ok := tenants[name]
+				if !ok {
+					t = &tenantCounts{}
+					tenants[name] = t
+				}
+				if client.Connected {
+					t.connections++
+				}
+				t.subscriptions += n
+			}
+			if client.Connected {
+				received.add(client.ClientID, float64(client.RecvOct))
+				sent.add(client.ClientID, float64(client.SendOct))
+			}
+		}
+
+		// the broker may serve fewer clients per page than requested
+		limit := clients.Meta.Limit
+		if limit <= 0 {
+			limit = clientsPageSize
+		}
+		if len(clients.Result) < limit || clients.Meta.Count > 0 && page*limit >= clients.Meta.Count {
+			break
+		}
+		if page == maxClientsPages {
+			logger.Warnf("Only the first %d clients of the node are counted in the client metrics", page*limit)
+		}
+	}
+	c.markSuccess("clients")
+
+	if c.opts.ClientSubscriptions {
+		ch <- prometheus.MustNewConstHistogram(clientSubscriptionsDesc, count, sum, buckets, labelValues...)
+	}
+	if c.opts.OfflineSessions {
+		ch <- prometheus.MustNewConstMetric(offlineSessionsDesc, prometheus.GaugeValue, float64(offline), labelValues...)
+		ch <- prometheus.MustNewConstMetric(offlineQueuedMessagesDesc, prometheus.GaugeValue, queued, labelValues...)
+	}
+	for direction, top := range map[string]*topClients{"received": received, "sent": sent} {
+		for _, client := range top.sorted() {
+			clientLabels := append(append([]string{}, labelValues...), client.clientID, direction)
+			ch <- prometheus.MustNewConstMetric(topClientBytesDesc, prometheus.CounterValue, client.value, clientLabels...)
+		}
+	}
+	for name, t := range tenants {
+		tenantLabels := append(append([]string{}, labelValues...), name)
+		ch <- prometheus.MustNewConstMetric(tenantConnectionsDesc, prometheus.GaugeValue, t.connections, tenantLabels...)
+		ch <- prometheus.MustNewConstMetric(tenantSubscriptionsDesc, prometheus.GaugeValue, t.subscriptions, tenantLabels...)
+	}
+}
@@ -0,0 +1,18 @@
+package collector
+
+import (
+	"time"
+)
+
+// brokerTimeLayout is the layout of the datetime reported by the
+// management endpoint, in the local time of the broker
+const brokerTimeLayout = "2006-01-02 15:04:05"
+
+// parseBrokerTime parses the datetime reported by a broker. Datetimes
+// without a zone are taken to be in the local time of the exporter.
+func parseBrokerTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(brokerTimeLayout, s, time.Local)
+}
@@ -0,0 +1,1820 @@
+// Package collector implements a Prometheus collector for an EMQ node
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/larseen/emq_exporter/pkg/expr"
+	"github.com/larseen/emq_exporter/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// Namespace is the prefix of the metrics of the collector
+const Namespace = "emq"
+
+var defaultLabels = []string{"node", "version"}
+
+type metric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(values combinedResponse) float64
+	// Present reports whether the broker returned the value, it is always emitted when nil
+	Present func(values combinedResponse) bool
+	// labelPairs are the label pairs added to the default labels, sorted by name
+	labelPairs []*dto.LabelPair
+	// cluster metrics describe the whole cluster and are emitted without
+	// the default labels of the scraped node, unless
+	// Options.NodeLabelsOnClusterMetrics is set
+	cluster bool
+	// name is the fully-qualified name of the metric, by which derived
+	// metrics reference it
+	name string
+}
+
+// derivedMetric is a gauge computed from the metrics of the node
+type derivedMetric struct {
+	Name string
+	Desc *prometheus.Desc
+	Expr *expr.Expr
+}
+
+type customMetric struct {
+	Type     prometheus.ValueType
+	Desc     *prometheus.Desc
+	Endpoint string
+	JSONPath string
+}
+
+func hasUsedFds(values combinedResponse) bool {
+	return values.nodes.Result.UsedFds != nil
+}
+
+func hasWildcardSubscriptions(values combinedResponse) bool {
+	return values.stats.Result.WildcardSubscriptionsCount != nil
+}
+
+func hasClusterVersions(values combinedResponse) bool {
+	return values.ClusterVersions > 0
+}
+
+// countVersions returns the number of distinct broker version and OTP
+// release pairs of the nodes of the cluster, more than 1 during a rolling
+// upgrade
+func countVersions(nodes []emqapi.ManagementResponseResult) int {
+	versions := make(map[[2]string]bool, len(nodes))
+	for _, n := range nodes {
+		versions[[2]string{n.Version, n.OtpRelease}] = true
+	}
+	return len(versions)
+}
+
+// parseOTPRelease splits an otp_release such as "R21/10.3.2" into the OTP
+// release and the ERTS version
+func parseOTPRelease(release string) (string, string) {
+	parts := strings.SplitN(release, "/", 2)
+	if len(parts) == 1 {
+		return strings.TrimSpace(parts[0]), ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// EMQFetcher fetches the API responses of a single EMQ node, it is
+// implemented by emqapi.HTTPClient and can be replaced by fakes in tests
+// or by other transports
+type EMQFetcher interface {
+	// Node returns the name of the node
+	Node() string
+	// APIVersion returns the API version spoken by the node
+	APIVersion(ctx context.Context) (*emqapi.APIVersion, error)
+	Nodes(ctx context.Context) (emqapi.NodesResponse, error)
+	Metrics(ctx context.Context) (emqapi.MetricsResponse, error)
+	Stats(ctx context.Context) (emqapi.StatsResponse, error)
+	Management(ctx context.Context) (emqapi.ManagementResponse, error)
+	// Custom fetches an arbitrary endpoint, replacing {node} in path with the node name
+	Custom(ctx context.Context, path string) (interface{}, error)
+}
+
+var _ EMQFetcher = (*emqapi.HTTPClient)(nil)
+
+// FailoverFetcher is implemented by fetchers able to fail over to a
+// fallback URL of the node
+type FailoverFetcher interface {
+	HasFallback() bool
+	// Serving returns emqapi.URLPrimary or emqapi.URLFallback
+	Serving() string
+}
+
+var _ FailoverFetcher = (*emqapi.HTTPClient)(nil)
+
+// Options holds the optional settings of the collector
+type Options struct {
+	// MinScrapeInterval is the minimum time between two scrapes of the broker,
+	// faster scrapes are answered from the previous result
+	MinScrapeInterval time.Duration
+	// MemoryUnitBase is the base of memory units without an explicit
+	// "i", either emqapi.DecimalUnitBase or emqapi.BinaryUnitBase
+	MemoryUnitBase float64
+	// Tracer exports the spans of every scrape, tracing is disabled when nil
+	Tracer *tracing.Tracer
+	// LegacyNames serves the metric names used before the unit
+	// normalization, with the counters of the metrics endpoint as gauges
+	LegacyNames bool
+	// LabeledFamilies merges related metrics into families told apart by
+	// labels, e.g. the sent and received bytes by a direction label and the
+	// messages of every QoS level by a qos label
+	LabeledFamilies bool
+	// CompatUntil is the end of the transition period during which the old
+	// names of renamed metrics are served next to the current ones
+	CompatUntil time.Time
+	// BrokerTimestamps timestamps the samples of the node with the datetime
+	// reported by the broker instead of the time of the scrape
+	BrokerTimestamps bool
+	// ResponseSizeWarning is the size of API responses in bytes above which
+	// a warning is logged, 0 disables the warning
+	ResponseSizeWarning int64
+	// License exports the license of enterprise brokers, fetched from
+	// fetchers implementing LicenseFetcher
+	License bool
+	// ClientSubscriptions pages through the clients of the node, fetched
+	// from fetchers implementing ClientsFetcher, and exports a histogram of
+	// their subscription counts
+	ClientSubscriptions bool
+	// OfflineSessions pages through the clients of the node like
+	// ClientSubscriptions and exports the number of persistent sessions of
+	// disconnected clients and the messages queued for them
+	OfflineSessions bool
+	// TopClients pages through the clients of the node like
+	// ClientSubscriptions and exports the traffic of the TopClients clients
+	// receiving and sending the most bytes, disabled if 0
+	TopClients int
+	// Exhooks exports the status and invocation counters of the gRPC
+	// servers of the exhook extension, fetched from fetchers implementing
+	// ExhookFetcher
+	Exhooks bool
+	// Gateways exports the clients and messages of the multi-protocol
+	// gateways, fetched from fetchers implementing GatewaysFetcher
+	Gateways bool
+	// Congestion exports the slow subscribers and the connections with a
+	// congestion alarm, fetched from fetchers implementing CongestionFetcher
+	Congestion bool
+	// Listeners exports the connections, limits and shutdowns of the
+	// protocol listeners, fetched from fetchers implementing
+	// ListenersFetcher
+	Listeners bool
+	// CompensateCounterResets adds the values of the counters of the node
+	// before a reset of the broker to the exported values, for backends
+	// which take a decreasing counter for a negative increase
+	CompensateCounterResets bool
+	// ScrapeDurationWindow is the window of the scrape duration quantiles,
+	// 10 minutes if 0
+	ScrapeDurationWindow time.Duration
+	// CapabilityInterval is the interval at which the optional endpoints
+	// the node answered with 404 are requested again, 1 hour if 0
+	CapabilityInterval time.Duration
+	// StaleCacheFile persists the last good scrape, which is served for up
+	// to StaleMaxAge while the node is unreachable, disabled if empty
+	StaleCacheFile string
+	StaleMaxAge    time.Duration
+	// ErrorLogEvery logs only the first and every Nth repetition of the
+	// same scrape error, and its recovery, every error is logged if <= 1
+	ErrorLogEvery int
+	// NodeLabelsOnClusterMetrics keeps the default labels of the scraped
+	// node on cluster metrics like emq_cluster_size, as served before
+	NodeLabelsOnClusterMetrics bool
+	// NodeNameFallback uses the only node of the management endpoint for
+	// the version label when none matches the node name, e.g. a node
+	// renamed in a single node deployment
+	NodeNameFallback bool
+}
+
+// Collector is the struct for the EMQ Collector
+type Collector struct {
+	client EMQFetcher
+
+	opts       Options
+	scrapeMtx  sync.Mutex
+	lastScrape time.Time
+	cached     []prometheus.Metric
+	healthMtx  sync.Mutex
+	health     Health
+	flightMtx  sync.Mutex
+	flight     *scrapeCall
+	caps       capabilities
+	errorLog   *errorLog
+	// stale is the last good scrape if a stale cache file is configured
+	stale       *staleResponse
+	staleLoaded bool
+
+	up                prometheus.Gauge
+	totalScrapes      prometheus.Counter
+	jsonParseFailures prometheus.Counter
+	cachedScrapes     prometheus.Counter
+	coalescedScrapes  prometheus.Counter
+	scrapeDuration    prometheus.Summary
+	authFailures      prometheus.Counter
+	throttled         prometheus.Counter
+	dnsFailures       prometheus.Counter
+	counterResets     prometheus.Counter
+	apiErrors         *prometheus.CounterVec
+	lastSuccess       *prometheus.GaugeVec
+	requestDuration   *prometheus.HistogramVec
+	responseBytes     *prometheus.GaugeVec
+	servingURL        *prometheus.GaugeVec
+	missingFields     *prometheus.CounterVec
+	unknownFields     *prometheus.CounterVec
+	lastScrapeError   *prometheus.GaugeVec
+	servingStale      prometheus.Gauge
+	nodeNameMismatch  prometheus.Gauge
+	deprecatedScraped *prometheus.CounterVec
+	deprecated        map[*prometheus.Desc]*deprecatedMetric
+	targetInfo        *prometheus.Desc
+	erlangInfo        *prometheus.Desc
+	clockSkew         *prometheus.Desc
+	metrics           []*metric
+	customMetrics     []*customMetric
+	derivedMetrics    []*derivedMetric
+	// topicMetrics are the topics registered for the topic metrics
+	topicMetrics []string
+	// intervals are the minimum intervals between the runs of the optional
+	// collectors, by collector name
+	intervals    map[string]time.Duration
+	intervalRuns map[string]*intervalRun
+	// counters are the last values of the counters of the node
+	counters map[*metric]*counterState
+	// tenantRE extracts the tenants of the clients from their client ID,
+	// or their username if tenantByUsername is set, disabled if nil
+	tenantRE         *regexp.Regexp
+	tenantByUsername bool
+	// infos is the metadata of the descriptors created by the collector
+	infos *metricInfos
+}
+
+// New initializes every descriptor and returns a collector scraping the node
+// fetched by emq. Fetchers accepting an emqapi.Observer report their
+// requests to the collector.
+func New(emq EMQFetcher, cfg *config.Config, opts Options) *Collector {
+	scrapeDurationWindow := opts.ScrapeDurationWindow
+	if scrapeDurationWindow <= 0 {
+		scrapeDurationWindow = 10 * time.Minute
+	}
+	infos := newMetricInfos()
+
+	var customMetrics []*customMetric
+	for _, m := range cfg.AllCustomMetrics() {
+		valueType, _ := config.ParseValueType(m.Type)
+		customMetrics = append(customMetrics, &customMetric{
+			Type: valueType,
+			Desc: infos.newDesc(
+				m.Name,
+				m.Help,
+				valueType,
+				defaultLabels, nil,
+			),
+			Endpoint: m.Endpoint,
+			JSONPath: m.JSONPath,
+		})
+	}
+
+	var derivedMetrics []*derivedMetric
+	for _, m := range cfg.DerivedMetrics {
+		e, _ := expr.Parse(m.Expr)
+		help := m.Help
+		if help == "" {
+			help = "Value of " + m.Expr + "."
+		}
+		derivedMetrics = append(derivedMetrics, &derivedMetric{
+			Name: m.Name,
+			Desc: infos.newDesc(m.Name, help, prometheus.GaugeValue, defaultLabels, nil),
+			Expr: e,
+		})
+	}
+
+	name := func(fqName string) string {
+		if legacy, ok := legacyNames[fqName]; ok && opts.LegacyNames {
+			return legacy
+		}
+		return fqName
+	}
+	counterType := prometheus.CounterValue
+	if opts.LegacyNames {
+		counterType = prometheus.GaugeValue
+	}
+	var clusterLabels []string
+	if opts.NodeLabelsOnClusterMetrics {
+		clusterLabels = defaultLabels
+	}
+
+	var tenantRE *regexp.Regexp
+	var tenantByUsername bool
+	if cfg.Tenants != nil {
+		tenantRE = regexp.MustCompile(cfg.Tenants.Regex)
+		tenantByUsername = cfg.Tenants.Field == "username"
+	}
+
+	c := &Collector{
+		client:           emq,
+		opts:             opts,
+		infos:            infos,
+		customMetrics:    customMetrics,
+		derivedMetrics:   derivedMetrics,
+		topicMetrics:     cfg.TopicMetrics,
+		intervals:        cfg.CollectorIntervals(),
+		intervalRuns:     make(map[string]*intervalRun),
+		counters:         make(map[*metric]*counterState),
+		tenantRE:         tenantRE,
+		tenantByUsername: tenantByUsername,
+		errorLog:         newErrorLog(opts.ErrorLogEvery),
+		up: infos.newGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "node", "up"),
+			Help: "Was the last scrape of the EMQ node successful.",
+		}),
+		totalScrapes: infos.newCounter(prometheus.CounterOpts{
+			Name: name(prometheus.BuildFQName(Namespace, "exporter", "scrapes_total")),
+			Help: "Total number of scrapes of the EMQ node.",
+		}),
+		jsonParseFailures: infos.newCounter(prometheus.CounterOpts{
+			Name: name(prometheus.BuildFQName(Namespace, "exporter", "json_parse_failures_total")),
+			Help: "Number of EMQ API responses that could not be decoded.",
+		}),
+		scrapeDuration: infos.newSummary(prometheus.SummaryOpts{
+			Name:       prometheus.BuildFQName(Namespace, "exporter", "scrape_duration_seconds"),
+			Help:       "Duration of the scrapes of the EMQ node, with quantiles over a rolling window.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     scrapeDurationWindow,
+		}),
+		coalescedScrapes: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "coalesced_scrapes_total"),
+			Help: "Number of scrapes served the result of a concurrent scrape of the EMQ node.",
+		}),
+		cachedScrapes: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "cached_scrapes_total"),
+			Help: "Number of scrapes answered from the previous result because they arrived faster than the minimum scrape interval.",
+		}),
+		authFailures: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "auth_failures_total"),
+			Help: "Number of API requests rejected by the EMQ node because of invalid credentials.",
+		}),
+		throttled: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "throttled_total"),
+			Help: "Number of API requests rejected by the EMQ node with 429 Too Many Requests. The node is not marked as down while the exporter backs off.",
+		}),
+		dnsFailures: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "dns_lookup_failures_total"),
+			Help: "Number of failed DNS lookups of the hostname of the EMQ node, counted even when the cached addresses are used.",
+		}),
+		counterResets: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "counter_resets_total"),
+			Help: "Number of times a counter of the EMQ node was lower than at the previous scrape, e.g. after a restart of the broker.",
+		}),
+		apiErrors: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "api_errors_total"),
+			Help: "Number of API responses with a non-zero result code, by code and endpoint.",
+		}, []string{"code", "endpoint"}),
+		lastSuccess: infos.newGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "last_successful_scrape_timestamp_seconds"),
+			Help: "Unix timestamp of the last successful scrape of each EMQ API endpoint.",
+		}, []string{"endpoint"}),
+		requestDuration: infos.newHistogramVec(prometheus.HistogramOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "request_duration_seconds"),
+			Help: "Duration of the EMQ API requests, by endpoint.",
+		}, []string{"endpoint"}),
+		responseBytes: infos.newGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "api_response_bytes"),
+			Help: "Size of the last response of the EMQ API, by endpoint.",
+		}, []string{"endpoint"}),
+		servingURL: infos.newGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "serving_url"),
+			Help: "Which URL of the EMQ node served the last scrape, 1 for the primary or fallback url label, only exported when a fallback URL is configured.",
+		}, []string{"url"}),
+		servingStale: infos.newGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "serving_stale"),
+			Help: "Whether the last scrape served the metrics of the last good scrape from the stale cache because the EMQ node was unreachable.",
+		}),
+		nodeNameMismatch: infos.newGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "node_name_mismatch"),
+			Help: "Whether the node name matched none of the nodes of the management endpoint in the last scrape, which leaves the version label empty unless the fallback to the only node applied.",
+		}),
+		lastScrapeError: infos.newGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "last_scrape_error"),
+			Help: "Why the last scrape of the EMQ node failed, 1 for the type of the error and 0 for the others, all 0 if it succeeded.",
+		}, []string{"type"}),
+		missingFields: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "missing_fields_total"),
+			Help: "Number of times a field was missing from an EMQ API response or could not be parsed, by field and endpoint. The metrics of the field are not exported then.",
+		}, []string{"field", "endpoint"}),
+		unknownFields: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "unknown_fields_total"),
+			Help: "Number of keys of the EMQ API responses the exporter does not map, by endpoint, counted in strict decode mode.",
+		}, []string{"endpoint"}),
+		deprecatedScraped: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "exporter", "deprecated_metric_scraped_total"),
+			Help: "Number of times a metric was served under a deprecated name, by name.",
+		}, []string{"name"}),
+		erlangInfo: infos.newDesc(
+			prometheus.BuildFQName(Namespace, "node", "erlang_info"),
+			"Erlang/OTP release of the EMQ node, the value is always 1.",
+			prometheus.GaugeValue,
+			[]string{"node", "otp_release", "erts_version"}, nil,
+		),
+		clockSkew: infos.newDesc(
+			prometheus.BuildFQName(Namespace, "node", "clock_skew_seconds"),
+			"Difference between the datetime reported by the EMQ node and the clock of the exporter, in seconds.",
+			prometheus.GaugeValue,
+			defaultLabels, nil,
+		),
+		targetInfo: infos.newDesc(
+			prometheus.BuildFQName(Namespace, "exporter", "target_info"),
+			"Information about the scraped EMQ node, the value is always 1.",
+			prometheus.GaugeValue,
+			[]string{"api_version", "broker_version"}, nil,
+		),
+		metrics: append([]*metric{
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "cluster", "size"),
+					"Number of nodes in the EMQ cluster.",
+					prometheus.GaugeValue,
+					clusterLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.ClusterSize)
+				},
+				cluster: true,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "cluster", "version_skew"),
+					"Number of distinct broker versions and OTP releases of the nodes of the EMQ cluster, more than 1 during a rolling upgrade.",
+					prometheus.GaugeValue,
+					clusterLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.ClusterVersions)
+				},
+				Present: hasClusterVersions,
+				cluster: true,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "node", "process_used"),
+					"Number of Erlang processes used by the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.nodes.Result.ProcessesUsed)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "node", "process_available"),
+					"Maximum number of Erlang processes available to the EMQ node (the process limit).",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.nodes.Result.ProcessesAvailable)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "node", "process_utilization_ratio")),
+					"The ratio of used processes to the process limit of the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.nodes.Result.ProcessesUsed) / float64(values.nodes.Result.ProcessesAvailable)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.nodes.Result.ProcessesAvailable > 0
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "node", "max_fds"),
+					"Maximum number of file descriptors available to the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.nodes.Result.MaxFds)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "node", "fds_used"),
+					"Number of file descriptors used by the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.nodes.Result.UsedFds)
+				},
+				Present: hasUsedFds,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "node", "fds_remaining"),
+					"Number of file descriptors still available to the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.nodes.Result.MaxFds - *values.nodes.Result.UsedFds)
+				},
+				Present: hasUsedFds,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "node", "fds_utilization_ratio")),
+					"The ratio of used to available file descriptors of the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.nodes.Result.UsedFds) / float64(values.nodes.Result.MaxFds)
+				},
+				Present: func(values combinedResponse) bool {
+					return hasUsedFds(values) && values.nodes.Result.MaxFds > 0
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "node", "memory_total_bytes")),
+					"Total amount of memory available to the EMQ node in bytes.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					v, _ := emqapi.ParseMemory(string(values.nodes.Result.MemoryTotal), opts.MemoryUnitBase)
+					return v
+				},
+				Present: func(values combinedResponse) bool {
+					_, err := emqapi.ParseMemory(string(values.nodes.Result.MemoryTotal), opts.MemoryUnitBase)
+					return err == nil
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "node", "memory_used_bytes")),
+					"Amount of memory used by the EMQ node in bytes.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					v, _ := emqapi.ParseMemory(string(values.nodes.Result.MemoryUsed), opts.MemoryUnitBase)
+					return v
+				},
+				Present: func(values combinedResponse) bool {
+					_, err := emqapi.ParseMemory(string(values.nodes.Result.MemoryUsed), opts.MemoryUnitBase)
+					return err == nil
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_disconnect_total")),
+					"Number of DISCONNECT packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsDisconnect)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos2_received_total")),
+					"Number of QoS 2 messages received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos2Received)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_suback_total")),
+					"Number of SUBACK packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsSuback)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubcomp_received_total")),
+					"Number of PUBCOMP packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubcompReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_unsuback_total")),
+					"Number of UNSUBACK packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsUnsuback)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pingresp_total")),
+					"Number of PINGRESP packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPingresp)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pingreq_total")),
+					"Number of PINGREQ packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPingreq)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubrel_missed_total")),
+					"Number of PUBREL packets the EMQ node expected but did not receive.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubrelMissed)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_sent_total")),
+					"Number of MQTT packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos2_sent_total")),
+					"Number of QoS 2 messages sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos2Sent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubrec_missed_total")),
+					"Number of PUBREC packets the EMQ node expected but did not receive.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubrecMissed)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_unsubscribe_total")),
+					"Number of UNSUBSCRIBE packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsUnsubscribe)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "received_bytes_total")),
+					"Number of bytes received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.BytesReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_connack_total")),
+					"Number of CONNACK packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsConnack)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_received_total")),
+					"Number of messages received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_dropped_total")),
+					"Number of messages dropped by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesDropped)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubrec_sent_total")),
+					"Number of PUBREC packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubrecSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_retained_total")),
+					"Number of retained messages published to the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesRetained)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_publish_received_total")),
+					"Number of PUBLISH packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPublishReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubcomp_sent_total")),
+					"Number of PUBCOMP packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubcompSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_connect_total")),
+					"Number of CONNECT packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsConnect)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_puback_received_total")),
+					"Number of PUBACK packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubackReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_sent_total")),
+					"Number of messages sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_publish_sent_total")),
+					"Number of PUBLISH packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPublishSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "sent_bytes_total")),
+					"Number of bytes sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.BytesSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_puback_sent_total")),
+					"Number of PUBACK packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubackSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos2_dropped_total")),
+					"Number of QoS 2 messages dropped by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos2Dropped)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubrel_sent_total")),
+					"Number of PUBREL packets sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubrelSent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos1_sent_total")),
+					"Number of QoS 1 messages sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos1Sent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubrel_received_total")),
+					"Number of PUBREL packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubrelReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos1_received_total")),
+					"Number of QoS 1 messages received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos1Received)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos0_sent_total")),
+					"Number of QoS 0 messages sent by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos0Sent)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "messages_qos0_received_total")),
+					"Number of QoS 0 messages received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.MessagesQos0Received)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_received_total")),
+					"Number of MQTT packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubrec_received_total")),
+					"Number of PUBREC packets received by the EMQ node.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubrecReceived)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_pubcomp_missed_total")),
+					"Number of PUBCOMP packets the EMQ node expected but did not receive.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubcompMissed)
+				},
+			},
+			{
+				Type: counterType,
+				Desc: infos.newDesc(
+					name(prometheus.BuildFQName(Namespace, "metric", "packets_puback_missed_total")),
+					"Number of PUBACK packets the EMQ node expected but did not receive.",
+					counterType,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.metrics.Result.PacketsPubackMissed)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "messages_expired_total"),
+					"Number of messages dropped by the EMQ node because their expiry interval passed.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.MessagesExpired)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.MessagesExpired != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "messages_forward_total"),
+					"Number of messages forwarded by the EMQ node to other nodes of the cluster.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.MessagesForward)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.MessagesForward != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "messages_qos2_expired_total"),
+					"Number of QoS 2 messages expired before the EMQ node received their PUBREL.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.MessagesQos2Expired)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.MessagesQos2Expired != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "messages_dropped_await_pubrel_timeout_total"),
+					"Number of QoS 2 messages dropped by the EMQ node after waiting too long for their PUBREL.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.MessagesDroppedAwaitPubrelTimeout)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.MessagesDroppedAwaitPubrelTimeout != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "client_acl_checks_total"),
+					"Number of authorization checks of publishes and subscriptions run by the EMQ node, including those answered by the ACL cache.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.ClientCheckACL)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.ClientCheckACL != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "client_acl_allowed_total"),
+					"Number of publishes and subscriptions the EMQ node authorized.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.ClientACLAllow)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.ClientACLAllow != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "client_acl_denied_total"),
+					"Number of publishes and subscriptions the EMQ node denied by its ACL rules.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.ClientACLDeny)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.ClientACLDeny != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "client_acl_cache_hits_total"),
+					"Number of authorization checks of the EMQ node answered by the ACL cache.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.ClientACLCacheHit)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.ClientACLCacheHit != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "packets_publish_auth_error_total"),
+					"Number of PUBLISH packets the EMQ node rejected because the client was not authorized.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.PacketsPublishAuthError)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.PacketsPublishAuthError != nil
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "metric", "packets_subscribe_auth_error_total"),
+					"Number of SUBSCRIBE packets the EMQ node rejected because the client was not authorized.",
+					prometheus.CounterValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.metrics.Result.PacketsSubscribeAuthError)
+				},
+				Present: func(values combinedResponse) bool {
+					return values.metrics.Result.PacketsSubscribeAuthError != nil
+				},
+			},
+
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "stats", "subscriptions_wildcard"),
+					"Number of wildcard subscriptions in use by the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(*values.stats.Result.WildcardSubscriptionsCount)
+				},
+				Present: hasWildcardSubscriptions,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: infos.newDesc(
+					prometheus.BuildFQName(Namespace, "stats", "subscriptions_exact"),
+					"Number of exact (non-wildcard) subscriptions in use by the EMQ node.",
+					prometheus.GaugeValue,
+					defaultLabels, nil,
+				),
+				Value: func(values combinedResponse) float64 {
+					return float64(values.stats.Result.SubscriptionsCount - *values.stats.Result.WildcardSubscriptionsCount)
+				},
+				Present: hasWildcardSubscriptions,
+			},
+		}, statsMetrics(infos)...),
+	}
+
+	if opts.LabeledFamilies {
+		c.metrics = labelFamilies(infos, c.metrics, append(directionFamilies, qosFamilies...))
+	}
+	for _, m := range c.metrics {
+		if info, ok := infos.lookup(m.Desc); ok {
+			m.name = info.Name
+		}
+	}
+	c.setScrapeError("")
+	c.setupDeprecated()
+	if o, ok := emq.(interface{ SetObserver(emqapi.Observer) }); ok {
+		o.SetObserver(c)
+	}
+	return c
+}
+
+// recordAPIError counts and logs a non-zero result code returned by an endpoint
+func (c *Collector) recordAPIError(logger log.Logger, endpoint string, code int) {
+	c.apiErrors.WithLabelValues(strconv.Itoa(code), endpoint).Inc()
+	c.errorLog.Error(logger, fmt.Errorf("EMQ API %s endpoint returned code %d: %s", endpoint, code, emqapi.ErrorMeaning(code)))
+}
+
+// ObserveRequest implements emqapi.Observer, recording the request duration
+// and counting decoding errors, rejected credentials and throttled requests
+func (c *Collector) ObserveRequest(endpoint string, duration time.Duration, err error) {
+	c.requestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	switch e := err.(type) {
+	case *emqapi.DecodeError:
+		c.jsonParseFailures.Inc()
+	case *emqapi.AuthError:
+		c.authFailures.Inc()
+	case *emqapi.ThrottledError:
+		if !e.Skipped {
+			c.throttled.Inc()
+		}
+	}
+}
+
+// ObserveResponseSize implements emqapi.SizeObserver, recording the size of
+// the last response of every endpoint
+func (c *Collector) ObserveResponseSize(endpoint string, bytes int64) {
+	c.responseBytes.WithLabelValues(endpoint).Set(float64(bytes))
+	if c.opts.ResponseSizeWarning > 0 && bytes > c.opts.ResponseSizeWarning {
+		log.Warnf("EMQ API %s endpoint of %s returned %d bytes, more than the %d bytes warning threshold", endpoint, c.client.Node(), bytes, c.opts.ResponseSizeWarning)
+	}
+}
+
+// ObserveUnknownFields implements emqapi.UnknownFieldsObserver, counting the
+// keys of the responses the exporter does not map
+func (c *Collector) ObserveUnknownFields(endpoint string, fields []string) {
+	c.unknownFields.WithLabelValues(endpoint).Add(float64(len(fields)))
+	log.Debugf("EMQ API %s endpoint of %s returned unknown fields %s", endpoint, c.client.Node(), strings.Join(fields, ", "))
+}
+
+// ObserveDNSLookupFailure implements emqapi.DNSObserver, counting the failed
+// lookups of the broker hostname
+func (c *Collector) ObserveDNSLookupFailure(host string, err error) {
+	c.dnsFailures.Inc()
+	log.Debugf("DNS lookup of %s failed: %s", host, err)
+}
+
+// fail marks the node as down after a failed API request, unless the
+// management API only throttled the request
+func (c *Collector) fail(logger log.Logger, health *Health, err error) {
+	health.LastError = err.Error()
+	health.ErrorType = classifyError(err)
+	c.setScrapeError(health.ErrorType)
+	c.errorLog.Error(logger, err)
+	if health.ErrorType == "throttled" {
+		health.Up = c.Health().Up
+		return
+	}
+	c.up.Set(0)
+}
+
+// markSuccess records the time of the last successful scrape of an endpoint
+func (c *Collector) markSuccess(endpoint string) {
+	c.lastSuccess.WithLabelValues(endpoint).Set(float64(time.Now().Unix()))
+}
+
+// Describe is the describe fucntion function used by the prometheus package
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	described := make(map[*prometheus.Desc]bool)
+	for _, metric := range c.metrics {
+		if !described[metric.Desc] {
+			described[metric.Desc] = true
+			ch <- metric.Desc
+		}
+	}
+	ch <- c.targetInfo
+	ch <- c.erlangInfo
+	ch <- c.clockSkew
+	ch <- brokerInfoDesc
+	ch <- brokerUptimeDesc
+	ch <- brokerTimeDesc
+	if c.opts.License {
+		ch <- licenseExpiryDesc
+		ch <- licenseMaxConnectionsDesc
+	}
+	if c.opts.ClientSubscriptions {
+		ch <- clientSubscriptionsDesc
+	}
+	if c.opts.OfflineSessions {
+		ch <- offlineSessionsDesc
+		ch <- offlineQueuedMessagesDesc
+	}
+	if c.opts.TopClients > 0 {
+		ch <- topClientBytesDesc
+	}
+	if c.tenantRE != nil {
+		ch <- tenantConnectionsDesc
+		ch <- tenantSubscriptionsDesc
+	}
+	if c.opts.Exhooks {
+		ch <- exhookServerUpDesc
+		ch <- exhookServerCallsDesc
+		ch <- exhookHookCallsDesc
+	}
+	if c.opts.Gateways {
+		ch <- gatewayRunningDesc
+		ch <- gatewayClientsDesc
+		ch <- gatewayMaxClientsDesc
+		ch <- gatewayMessagesDesc
+	}
+	if c.opts.Congestion {
+		ch <- slowSubscribersDesc
+		ch <- congestedConnectionsDesc
+	}
+	if c.opts.Listeners {
+		ch <- listenerConnectionsDesc
+		ch <- listenerMaxConnectionsDesc
+		ch <- listenerMaxConnectionRateDesc
+		ch <- listenerShutdownsDesc
+	}
+	if len(c.topicMetrics) > 0 {
+		ch <- topicMessagesDesc
+		ch <- topicQoSMessagesDesc
+	}
+	for _, metric := range c.derivedMetrics {
+		ch <- metric.Desc
+	}
+	for _, metric := range c.customMetrics {
+		ch <- metric.Desc
+	}
+
+	c.describeExporter(ch)
+	for _, d := range c.deprecated {
+		if d.legacy != nil {
+			ch <- d.legacy
+		}
+	}
+}
+
+// describeExporter sends the descriptors of the metrics about the exporter,
+// which are inherited on reload
+func (c *Collector) describeExporter(ch chan<- *prometheus.Desc) {
+	ch <- c.up.Desc()
+	ch <- c.totalScrapes.Desc()
+	ch <- c.jsonParseFailures.Desc()
+	ch <- c.cachedScrapes.Desc()
+	ch <- c.coalescedScrapes.Desc()
+	ch <- c.scrapeDuration.Desc()
+	ch <- c.authFailures.Desc()
+	ch <- c.throttled.Desc()
+	ch <- c.dnsFailures.Desc()
+	ch <- c.counterResets.Desc()
+	c.lastSuccess.Describe(ch)
+	c.apiErrors.Describe(ch)
+	c.requestDuration.Describe(ch)
+	c.responseBytes.Describe(ch)
+	c.servingURL.Describe(ch)
+	c.missingFields.Describe(ch)
+	c.unknownFields.Describe(ch)
+	c.lastScrapeError.Describe(ch)
+	ch <- c.servingStale.Desc()
+	ch <- c.nodeNameMismatch.Desc()
+	c.deprecatedScraped.Describe(ch)
+}
+
+// Collect is the collect fucntion function used by the prometheus package
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(context.Background(), ch)
+}
+
+// CollectContext scrapes the broker with the API requests bound to ctx
+func (c *Collector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	if len(c.deprecated) > 0 {
+		var wait func()
+		ch, wait = c.withDeprecated(ch)
+		defer wait()
+	}
+
+	c.totalScrapes.Inc()
+	defer func() {
+		ch <- c.up
+		ch <- c.totalScrapes
+		ch <- c.jsonParseFailures
+		ch <- c.cachedScrapes
+		ch <- c.coalescedScrapes
+		ch <- c.scrapeDuration
+		ch <- c.authFailures
+		ch <- c.throttled
+		ch <- c.dnsFailures
+		ch <- c.counterResets
+		c.lastSuccess.Collect(ch)
+		c.apiErrors.Collect(ch)
+		c.requestDuration.Collect(ch)
+		c.responseBytes.Collect(ch)
+		c.missingFields.Collect(ch)
+		c.unknownFields.Collect(ch)
+		c.lastScrapeError.Collect(ch)
+		ch <- c.servingStale
+		ch <- c.nodeNameMismatch
+		if f, ok := c.client.(FailoverFetcher); ok && f.HasFallback() {
+			c.servingURL.Reset()
+			c.servingURL.WithLabelValues(f.Serving()).Set(1)
+			c.servingURL.Collect(ch)
+		}
+		c.deprecatedScraped.Collect(ch)
+	}()
+
+	for _, m := range c.shared(ctx) {
+		ch <- m
+	}
+}
+
+// scrapeCall is a scrape shared by the concurrent collections of the collector
+type scrapeCall struct {
+	done    chan struct{}
+	metrics []prometheus.Metric
+}
+
+// shared returns the metrics of the broker. Collections arriving while a
+// scrape is running wait for its result instead of requesting the broker
+// again, e.g. the scrapes of both members of an HA Prometheus pair.
+func (c *Collector) shared(ctx context.Context) []prometheus.Metric {
+	c.flightMtx.Lock()
+	if call := c.flight; call != nil {
+		c.flightMtx.Unlock()
+		c.coalescedScrapes.Inc()
+		select {
+		case <-call.done:
+			return call.metrics
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	call := &scrapeCall{done: make(chan struct{})}
+	c.flight = call
+	c.flightMtx.Unlock()
+
+	call.metrics = c.collectMetrics(ctx)
+
+	c.flightMtx.Lock()
+	c.flight = nil
+	c.flightMtx.Unlock()
+	close(call.done)
+	return call.metrics
+}
+
+// collectMetrics scrapes the broker, or returns the previous result if it
+// is less than the minimum scrape interval old
+func (c *Collector) collectMetrics(ctx context.Context) []prometheus.Metric {
+	if c.opts.MinScrapeInterval > 0 {
+		c.scrapeMtx.Lock()
+		defer c.scrapeMtx.Unlock()
+
+		if c.cached != nil && time.Since(c.lastScrape) < c.opts.MinScrapeInterval {
+			log.Warnf("Scrape arrived within %s of the previous one, serving cached result", c.opts.MinScrapeInterval)
+			c.cachedScrapes.Inc()
+			return c.cached
+		}
+	}
+
+	metricCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for m := range metricCh {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	c.scrape(ctx, metricCh)
+	close(metricCh)
+	<-done
+
+	if c.opts.MinScrapeInterval > 0 {
+		c.cached = metrics
+		c.lastScrape = time.Now()
+	}
+	return metrics
+}
+
+// emitNodeMetrics sends the metrics of the nodes, metrics and stats
+// endpoints and the derived metrics computed from them
+func (c *Collector) emitNodeMetrics(ch chan<- prometheus.Metric, values combinedResponse, snapshot []*dto.LabelPair, timestamp *int64) {
+	var vars map[string]float64
+	if len(c.derivedMetrics) > 0 {
+		vars = make(map[string]float64, len(c.metrics))
+	}
+	for _, metric := range c.metrics {
+		if metric.Present != nil && !metric.Present(values) {
+			continue
+		}
+		labels := snapshot
+		if metric.cluster && !c.opts.NodeLabelsOnClusterMetrics {
+			labels = nil
+		}
+		if len(metric.labelPairs) > 0 {
+			labels = mergeLabelPairs(labels, metric.labelPairs)
+		}
+		value := metric.Value(values)
+		if metric.Type == prometheus.CounterValue {
+			value = c.counterValue(metric, value)
+		}
+		ch <- &snapshotMetric{
+			desc:      metric.Desc,
+			valueType: metric.Type,
+			value:     value,
+			labels:    labels,
+			timestamp: timestamp,
+		}
+		// metrics of labeled families cannot be referenced by their name
+		if vars != nil && len(metric.labelPairs) == 0 {
+			vars[metric.name] = value
+		}
+	}
+
+	for _, metric := range c.derivedMetrics {
+		value, err := metric.Expr.Eval(vars)
+		if err != nil {
+			log.Debugf("Skipping derived metric %s of %s: %s", metric.Name, c.client.Node(), err)
+			continue
+		}
+		ch <- &snapshotMetric{
+			desc:      metric.Desc,
+			valueType: prometheus.GaugeValue,
+			value:     value,
+			labels:    snapshot,
+			timestamp: timestamp,
+		}
+	}
+}
+
+// scrape fetches the broker APIs and sends the resulting metrics to ch
+func (c *Collector) scrape(ctx context.Context, ch chan<- prometheus.Metric) {
+	ctx = tracing.WithTraceID(ctx, tracing.NewTraceID())
+	logger := tracing.Logger(ctx)
+	logger.Debug("Starting scrape")
+
+	var spans *tracing.Recorder
+	if c.opts.Tracer != nil {
+		spans = &tracing.Recorder{}
+		ctx = tracing.WithRecorder(ctx, spans)
+	}
+	ctx, root := tracing.StartSpan(ctx, "scrape", tracing.SpanKindInternal)
+	root.SetAttribute("emq.node", c.client.Node())
+	health := Health{Node: c.client.Node(), LastScrape: time.Now()}
+	// the stale cache is served when the scrape fails before any metric of
+	// the node was sent
+	var emitted, complete bool
+	c.servingStale.Set(0)
+	defer func() {
+		c.errorLog.end(logger, complete)
+		if !emitted {
+			c.serveStale(logger, ch)
+		}
+		health.Duration = time.Since(health.LastScrape)
+		c.scrapeDuration.Observe(health.Duration.Seconds())
+		c.setHealth(health)
+		root.Finish(nil)
+		if spans != nil {
+			c.opts.Tracer.Export(spans.Spans())
+		}
+	}()
+
+	api, err := c.client.APIVersion(ctx)
+	if err != nil {
+		c.fail(logger, &health, err)
+		return
+	}
+	health.APIVersion = api.Name()
+	c.caps.begin(c.opts.CapabilityInterval)
+
+	nodes, err := c.client.Nodes(ctx)
+	if err != nil {
+		c.fail(logger, &health, err)
+		return
+	}
+	if nodes.Code != 0 {
+		c.recordAPIError(logger, "nodes", nodes.Code)
+	}
+	c.markSuccess("nodes")
+	c.countMissingFields(logger, "nodes", nodes.Result)
+	for field, v := range map[string]emqapi.MemoryString{"memory_total": nodes.Result.MemoryTotal, "memory_used": nodes.Result.MemoryUsed} {
+		if _, err := emqapi.ParseMemory(string(v), c.opts.MemoryUnitBase); err != nil {
+			c.countMissingField(logger, field, "nodes", err)
+		}
+	}
+
+	metrics, err := c.client.Metrics(ctx)
+	if err != nil {
+		c.fail(logger, &health, err)
+		return
+	}
+	if metrics.Code != 0 {
+		c.recordAPIError(logger, "metrics", metrics.Code)
+	}
+	c.markSuccess("metrics")
+	c.countMissingFields(logger, "metrics", metrics.Result)
+
+	stats, err := c.client.Stats(ctx)
+	if err != nil {
+		c.fail(logger, &health, err)
+		return
+	}
+	if stats.Code != 0 {
+		c.recordAPIError(logger, "stats", stats.Code)
+	}
+	c.markSuccess("stats")
+	c.countMissingFields(logger, "stats", stats.Result)
+
+	management, err := c.client.Management(ctx)
+	received := time.Now()
+	if err != nil {
+		c.fail(logger, &health, err)
+		return
+	}
+	if management.Code != 0 {
+		c.recordAPIError(logger, "management", management.Code)
+	}
+	c.markSuccess("management")
+
+	var ClusterSize = len(management.Result)
+	var managementData emqapi.ManagementResponseResult
+
+	matched := false
+	for _, v := range management.Result {
+		if v.Name == c.client.Node() {
+			managementData = v
+			matched = true
+		}
+	}
+	c.nodeNameMismatch.Set(0)
+	if !matched {
+		c.nodeNameMismatch.Set(1)
+		names := make([]string, 0, len(management.Result))
+		for _, v := range management.Result {
+			names = append(names, v.Name)
+		}
+		err := fmt.Errorf("node name %s matches none of the nodes %s of the management endpoint", c.client.Node(), strings.Join(names, ", "))
+		if c.opts.NodeNameFallback && len(management.Result) == 1 {
+			managementData = management.Result[0]
+			err = fmt.Errorf("%s, falling back to %s", err, managementData.Name)
+		}
+		c.errorLog.Error(logger, err)
+	}
+
+	values := combinedResponse{
+		nodes,
+		metrics,
+		stats,
+		ClusterSize,
+		countVersions(management.Result),
+	}
+
+	if values.nodes.Code == 0 {
+		c.up.Set(1)
+		health.Up = true
+		c.setScrapeError("")
+	} else {
+		c.up.Set(0)
+		health.LastError = fmt.Sprintf("nodes endpoint returned code %d: %s", nodes.Code, emqapi.ErrorMeaning(nodes.Code))
+		health.ErrorType = "other"
+		if authErrorCodes[nodes.Code] {
+			health.ErrorType = "auth"
+		}
+		c.setScrapeError(health.ErrorType)
+	}
+
+	emitted = true
+	brokerVersion := managementData.Version
+	if brokerVersion == "" {
+		brokerVersion = managementData.Sysdescr
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.targetInfo,
+		prometheus.GaugeValue,
+		1,
+		api.Name(),
+		brokerVersion,
+	)
+
+	otpRelease, ertsVersion := parseOTPRelease(values.nodes.Result.Release)
+	ch <- prometheus.MustNewConstMetric(
+		c.erlangInfo,
+		prometheus.GaugeValue,
+		1,
+		values.nodes.Result.NodeName,
+		otpRelease,
+		ertsVersion,
+	)
+
+	snapshot := newLabelPairs(defaultLabels, []string{values.nodes.Result.NodeName, managementData.Version})
+
+	var timestamp *int64
+	if brokerTime, err := parseBrokerTime(managementData.Datetime); err != nil {
+		logger.Debugf("Cannot parse the datetime %q of the node: %s", managementData.Datetime, err)
+	} else {
+		ch <- &snapshotMetric{
+			desc:      c.clockSkew,
+			valueType: prometheus.GaugeValue,
+			value:     brokerTime.Sub(received).Seconds(),
+			labels:    snapshot,
+		}
+		if c.opts.BrokerTimestamps {
+			timestamp = proto.Int64(brokerTime.UnixNano() / int64(time.Millisecond))
+		}
+	}
+	c.emitNodeMetrics(ch, values, snapshot, timestamp)
+	c.saveStale(logger, values, managementData.Version)
+
+	c.every("brokers", ch, func(ch chan<- prometheus.Metric) {
+		c.collectBrokers(ctx, logger, ch, snapshot)
+	})
+	if c.opts.License {
+		c.every("license", ch, func(ch chan<- prometheus.Metric) {
+			c.collectLicense(ctx, logger, ch, snapshot)
+		})
+	}
+	if c.opts.Exhooks {
+		c.every("exhooks", ch, func(ch chan<- prometheus.Metric) {
+			c.collectExhooks(ctx, logger, ch, snapshot)
+		})
+	}
+	if c.opts.Gateways {
+		c.every("gateways", ch, func(ch chan<- prometheus.Metric) {
+			c.collectGateways(ctx, logger, ch, snapshot)
+		})
+	}
+	if c.opts.Congestion {
+		c.every("congestion", ch, func(ch chan<- prometheus.Metric) {
+			c.collectCongestion(ctx, logger, ch, snapshot)
+		})
+	}
+	if c.opts.Listeners {
+		c.every("listeners", ch, func(ch chan<- prometheus.Metric) {
+			c.collectListeners(ctx, logger, ch, snapshot)
+		})
+	}
+	if len(c.topicMetrics) > 0 {
+		c.every("topic_metrics", ch, func(ch chan<- prometheus.Metric) {
+			c.collectTopicMetrics(ctx, logger, ch, snapshot)
+		})
+	}
+	if c.opts.ClientSubscriptions || c.opts.OfflineSessions || c.opts.TopClients > 0 || c.tenantRE != nil {
+		c.every("clients", ch, func(ch chan<- prometheus.Metric) {
+			c.collectClients(ctx, logger, ch, values.nodes.Result.NodeName, managementData.Version)
+		})
+	}
+
+	responses := make(map[string]interface{})
+	// failed endpoints are requested and logged once per scrape, however many
+	// metrics they have
+	failed := make(map[string]bool)
+	for _, metric := range c.customMetrics {
+		data, ok := responses[metric.Endpoint]
+		if !ok {
+			if failed[metric.Endpoint] || !c.caps.enabled(metric.Endpoint) {
+				continue
+			}
+			data, err = c.client.Custom(ctx, metric.Endpoint)
+			c.caps.record(metric.Endpoint, err)
+			if err != nil {
+				failed[metric.Endpoint] = true
+				c.optionalError(logger, err)
+				continue
+			}
+			c.markSuccess(metric.Endpoint)
+			responses[metric.Endpoint] = data
+		}
+
+		value, err := lookupJSONPath(data, metric.JSONPath)
+		if err != nil {
+			c.countMissingField(logger, metric.JSONPath, metric.Endpoint, err)
+			continue
+		}
+
+		ch <- &snapshotMetric{
+			desc:      metric.Desc,
+			valueType: metric.Type,
+			value:     value,
+			labels:    snapshot,
+			timestamp: timestamp,
+		}
+	}
+
+	c.caps.end(logger, c.client.Node(), api.Name())
+	complete = true
+}
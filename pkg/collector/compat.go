@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// deprecatedMetric is a metric served under a deprecated name
+type deprecatedMetric struct {
+	name string
+	// legacy is the descriptor of the old name served next to the current
+	// one, nil if the metric itself is served under the old name
+	legacy    *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+// setupDeprecated finds the metrics served under a deprecated name and
+// creates the descriptors of the old names served during the compat window
+func (c *Collector) setupDeprecated() {
+	current := []*prometheus.Desc{c.totalScrapes.Desc(), c.jsonParseFailures.Desc()}
+	for _, metric := range c.metrics {
+		current = append(current, metric.Desc)
+	}
+
+	oldNames := make(map[string]bool)
+	for _, old := range legacyNames {
+		oldNames[old] = true
+	}
+
+	c.deprecated = make(map[*prometheus.Desc]*deprecatedMetric)
+	for _, desc := range current {
+		info, ok := c.metricInfo(desc)
+		if !ok {
+			continue
+		}
+		if oldNames[info.Name] {
+			c.deprecated[desc] = &deprecatedMetric{name: info.Name}
+			continue
+		}
+
+		old, ok := legacyNames[info.Name]
+		if !ok || c.opts.CompatUntil.IsZero() {
+			continue
+		}
+		valueType := prometheus.GaugeValue
+		if legacyCounters[old] {
+			valueType = prometheus.CounterValue
+		}
+		c.deprecated[desc] = &deprecatedMetric{
+			name:      old,
+			legacy:    c.infos.newDesc(old, info.Help+" Deprecated, use "+info.Name+" instead.", valueType, info.Labels, nil),
+			valueType: valueType,
+		}
+	}
+}
+
+// withDeprecated returns a channel forwarding the metrics to ch, adding the
+// old names of renamed metrics during the compat window and counting the
+// deprecated names served. The returned function waits for the forwarding
+// to finish once the channel is closed.
+func (c *Collector) withDeprecated(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	compat := time.Now().Before(c.opts.CompatUntil)
+	out := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range out {
+			ch <- m
+
+			d, ok := c.deprecated[m.Desc()]
+			if !ok {
+				continue
+			}
+			if d.legacy == nil {
+				c.deprecatedScraped.WithLabelValues(d.name).Inc()
+				continue
+			}
+			if !compat {
+				continue
+			}
+
+			legacy, err := legacyMetric(d, m)
+			if err != nil {
+				log.Errorf("failed to serve deprecated metric %s: %s", d.name, err)
+				continue
+			}
+			ch <- legacy
+			c.deprecatedScraped.WithLabelValues(d.name).Inc()
+		}
+	}()
+	return out, func() {
+		close(out)
+		<-done
+	}
+}
+
+// legacyMetric copies the value and labels of m to the old name
+func legacyMetric(d *deprecatedMetric, m prometheus.Metric) (prometheus.Metric, error) {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		return nil, err
+	}
+
+	var value float64
+	switch {
+	case pb.Counter != nil:
+		value = pb.Counter.GetValue()
+	case pb.Gauge != nil:
+		value = pb.Gauge.GetValue()
+	default:
+		value = pb.Untyped.GetValue()
+	}
+
+	// the labels are sorted by name, like the labels of the legacy descriptor
+	labels := make([]string, 0, len(pb.Label))
+	for _, l := range pb.Label {
+		labels = append(labels, l.GetValue())
+	}
+	return prometheus.NewConstMetric(d.legacy, d.valueType, value, labels...)
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"strings"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// CongestionFetcher is implemented by the fetchers able to fetch the slow
+// subscriptions and the activated alarms of the cluster
+type CongestionFetcher interface {
+	SlowSubscriptions(ctx context.Context) (emqapi.SlowSubscriptionsResponse, error)
+	Alarms(ctx context.Context) (emqapi.AlarmsResponse, error)
+}
+
+var _ CongestionFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	slowSubscribersDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "", "slow_subscribers"),
+		"Number of subscriptions on the EMQ node among the slowest subscriptions tracked by the broker.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+	congestedConnectionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "", "congested_connections"),
+		"Number of connections of the EMQ node with an activated congestion alarm, whose socket buffers are full.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+)
+
+// congestionAlarmPrefix prefixes the names of the congestion alarms, which
+// are followed by the client ID and username
+const congestionAlarmPrefix = "conn_congestion"
+
+// collectCongestion sends the slow subscribers and congested connections of
+// the node, failures are logged without marking the node as down
+func (c *Collector) collectCongestion(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(CongestionFetcher)
+	if !ok {
+		return
+	}
+	node := c.client.Node()
+
+	if c.caps.enabled("slow_subscriptions") {
+		slow, err := fetcher.SlowSubscriptions(ctx)
+		c.caps.record("slow_subscriptions", err)
+		switch {
+		case err != nil:
+			c.optionalError(logger, err)
+		case slow.Code != 0:
+			c.recordAPIError(logger, "slow_subscriptions", slow.Code)
+		default:
+			c.markSuccess("slow_subscriptions")
+			count := 0
+			for _, s := range slow.Result {
+				if s.Node == node {
+					count++
+				}
+			}
+			ch <- &snapshotMetric{
+				desc:      slowSubscribersDesc,
+				valueType: prometheus.GaugeValue,
+				value:     float64(count),
+				labels:    labels,
+			}
+		}
+	}
+
+	if c.caps.enabled("alarms") {
+		alarms, err := fetcher.Alarms(ctx)
+		c.caps.record("alarms", err)
+		switch {
+		case err != nil:
+			c.optionalError(logger, err)
+		case alarms.Code != 0:
+			c.recordAPIError(logger, "alarms", alarms.Code)
+		default:
+			c.markSuccess("alarms")
+			count := 0
+			for _, n := range alarms.Result {
+				if n.Node != node {
+					continue
+				}
+				for _, a := range n.Alarms {
+					if strings.HasPrefix(a.Name, congestionAlarmPrefix) {
+						count++
+					}
+				}
+			}
+			ch <- &snapshotMetric{
+				desc:      congestedConnectionsDesc,
+				valueType: prometheus.GaugeValue,
+				value:     float64(count),
+				labels:    labels,
+			}
+		}
+	}
+}
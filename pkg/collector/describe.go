@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricInfo is the metadata of a descriptor, which the prometheus package does not expose
+type metricInfo struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+// metricInfos holds the metadata of descriptors. The descriptors of a
+// collector are kept by the collector, so the collectors replaced on reload
+// are not kept alive, the descriptors created once in packageInfos.
+type metricInfos struct {
+	mtx   sync.Mutex
+	infos map[*prometheus.Desc]*metricInfo
+}
+
+func newMetricInfos() *metricInfos {
+	return &metricInfos{infos: make(map[*prometheus.Desc]*metricInfo)}
+}
+
+// packageInfos holds the metadata of the descriptors created on package
+// initialization
+var packageInfos = newMetricInfos()
+
+func (i *metricInfos) record(desc *prometheus.Desc, info *metricInfo) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	i.infos[desc] = info
+}
+
+func (i *metricInfos) lookup(desc *prometheus.Desc) (*metricInfo, bool) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	info, ok := i.infos[desc]
+	return info, ok
+}
+
+// names returns the fully-qualified names of the descriptors
+func (i *metricInfos) names() []string {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	names := make([]string, 0, len(i.infos))
+	for _, info := range i.infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+// metricInfo returns the metadata of a descriptor described by the collector
+func (c *Collector) metricInfo(desc *prometheus.Desc) (*metricInfo, bool) {
+	if info, ok := c.infos.lookup(desc); ok {
+		return info, true
+	}
+	return packageInfos.lookup(desc)
+}
+
+// packageMetricNames are the names of the descriptors created on package
+// initialization, the optional metrics among them
+var packageMetricNames []string
+
+func init() {
+	packageMetricNames = packageInfos.names()
+}
+
+var (
+	builtinNamesOnce sync.Once
+	builtinNames     []string
+)
+
+// BuiltinMetricNames returns the names of the metrics the collector and the
+// $SYS source may serve with any options, without custom and derived
+// metrics. The names of the $SYS mappings keep their $1, $2, ... captures.
+func BuiltinMetricNames() []string {
+	builtinNamesOnce.Do(func() {
+		names := append([]string{}, packageMetricNames...)
+		for _, old := range legacyNames {
+			names = append(names, old)
+		}
+		for _, opts := range []Options{{}, {LegacyNames: true}, {LabeledFamilies: true}} {
+			names = append(names, New(nil, &config.Config{}, opts).infos.names()...)
+		}
+		builtinNames = append(names, sysMetricNames()...)
+	})
+	return append([]string{}, builtinNames...)
+}
+
+// newDesc wraps prometheus.NewDesc and records the descriptor metadata with
+// the value type of its const metrics
+func (i *metricInfos) newDesc(fqName, help string, valueType prometheus.ValueType, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+	i.record(desc, &metricInfo{
+		Name:   fqName,
+		Help:   help,
+		Type:   valueTypeName(valueType),
+		Labels: labelNames(variableLabels, constLabels),
+	})
+	return desc
+}
+
+// newHistogramDesc wraps prometheus.NewDesc and records the metadata of the
+// descriptor of const histograms
+func (i *metricInfos) newHistogramDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+	i.record(desc, &metricInfo{
+		Name:   fqName,
+		Help:   help,
+		Type:   "histogram",
+		Labels: labelNames(variableLabels, constLabels),
+	})
+	return desc
+}
+
+// newGauge wraps prometheus.NewGauge and records the gauge metadata
+func (i *metricInfos) newGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	g := prometheus.NewGauge(opts)
+	i.record(g.Desc(), &metricInfo{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   "gauge",
+		Labels: labelNames(nil, opts.ConstLabels),
+	})
+	return g
+}
+
+// newCounter wraps prometheus.NewCounter and records the counter metadata
+func (i *metricInfos) newCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	c := prometheus.NewCounter(opts)
+	i.record(c.Desc(), &metricInfo{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   "counter",
+		Labels: labelNames(nil, opts.ConstLabels),
+	})
+	return c
+}
+
+// newGaugeVec wraps prometheus.NewGaugeVec and records the gauge metadata
+func (i *metricInfos) newGaugeVec(opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(opts, labels)
+	ch := make(chan *prometheus.Desc, 1)
+	g.Describe(ch)
+	i.record(<-ch, &metricInfo{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   "gauge",
+		Labels: labelNames(labels, opts.ConstLabels),
+	})
+	return g
+}
+
+// newCounterVec wraps prometheus.NewCounterVec and records the counter metadata
+func (i *metricInfos) newCounterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labels)
+	ch := make(chan *prometheus.Desc, 1)
+	c.Describe(ch)
+	i.record(<-ch, &metricInfo{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   "counter",
+		Labels: labelNames(labels, opts.ConstLabels),
+	})
+	return c
+}
+
+// newSummary wraps prometheus.NewSummary and records the summary metadata
+func (i *metricInfos) newSummary(opts prometheus.SummaryOpts) prometheus.Summary {
+	sm := prometheus.NewSummary(opts)
+	i.record(sm.Desc(), &metricInfo{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   "summary",
+		Labels: labelNames(nil, opts.ConstLabels),
+	})
+	return sm
+}
+
+// newHistogramVec wraps prometheus.NewHistogramVec and records the histogram metadata
+func (i *metricInfos) newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(opts, labels)
+	ch := make(chan *prometheus.Desc, 1)
+	h.Describe(ch)
+	i.record(<-ch, &metricInfo{
+		Name:   prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		Help:   opts.Help,
+		Type:   "histogram",
+		Labels: labelNames(labels, opts.ConstLabels),
+	})
+	return h
+}
+
+func labelNames(variableLabels []string, constLabels prometheus.Labels) []string {
+	labels := append([]string{}, variableLabels...)
+	for name := range constLabels {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func valueTypeName(t prometheus.ValueType) string {
+	switch t {
+	case prometheus.CounterValue:
+		return "counter"
+	case prometheus.GaugeValue:
+		return "gauge"
+	default:
+		return "untyped"
+	}
+}
+
+// ListMetrics writes every metric described by the collector to w
+func ListMetrics(w io.Writer, c *Collector) error {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+
+	var infos []*metricInfo
+	for desc := range ch {
+		info, ok := c.metricInfo(desc)
+		if !ok {
+			info = &metricInfo{Name: desc.String()}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tLABELS\tHELP")
+	for _, info := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Name, info.Type, strings.Join(info.Labels, ","), info.Help)
+	}
+	return tw.Flush()
+}
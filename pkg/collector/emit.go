@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// snapshotMetric is a const metric sharing the label pairs of the node
+// snapshot it belongs to, so scraping large clusters does not allocate the
+// labels of every metric again
+type snapshotMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     float64
+	labels    []*dto.LabelPair
+	// timestamp is in milliseconds, the time of the scrape is used if nil
+	timestamp *int64
+}
+
+func (m *snapshotMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *snapshotMetric) Write(out *dto.Metric) error {
+	switch m.valueType {
+	case prometheus.CounterValue:
+		out.Counter = &dto.Counter{Value: proto.Float64(m.value)}
+	case prometheus.GaugeValue:
+		out.Gauge = &dto.Gauge{Value: proto.Float64(m.value)}
+	default:
+		out.Untyped = &dto.Untyped{Value: proto.Float64(m.value)}
+	}
+	// the full slice expression makes appending labels, like the target
+	// label of multi-target setups, copy the shared pairs
+	out.Label = m.labels[:len(m.labels):len(m.labels)]
+	out.TimestampMs = m.timestamp
+	return nil
+}
+
+// newLabelPairs returns the label pairs of names and values, sorted by name
+func newLabelPairs(names, values []string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(names))
+	for i, name := range names {
+		pairs = append(pairs, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(values[i]),
+		})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
+
+// mergeLabelPairs merges two sets of sorted label pairs
+func mergeLabelPairs(a, b []*dto.LabelPair) []*dto.LabelPair {
+	merged := make([]*dto.LabelPair, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	merged = append(merged, b...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].GetName() < merged[j].GetName() })
+	return merged
+}
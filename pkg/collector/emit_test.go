@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// the shape of a large cluster scrape: 50 nodes with 60 metrics each
+const (
+	benchNodes   = 50
+	benchMetrics = 60
+)
+
+func benchDescs() []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, benchMetrics)
+	for i := range descs {
+		descs[i] = prometheus.NewDesc(fmt.Sprintf("emq_bench_metric_%d", i), "Benchmark metric.", defaultLabels, nil)
+	}
+	return descs
+}
+
+// BenchmarkEmitConstMetrics emits the metrics the way the collector did
+// before snapshotMetric, building the label pairs of every metric
+func BenchmarkEmitConstMetrics(b *testing.B) {
+	descs := benchDescs()
+	var out dto.Metric
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < benchNodes; n++ {
+			node := fmt.Sprintf("emqx@10.0.0.%d", n)
+			for _, desc := range descs {
+				m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, node, "4.4.19")
+				m.Write(&out)
+			}
+		}
+	}
+}
+
+// BenchmarkEmitSnapshotMetrics emits the metrics sharing the label pairs of
+// the node snapshot
+func BenchmarkEmitSnapshotMetrics(b *testing.B) {
+	descs := benchDescs()
+	var out dto.Metric
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < benchNodes; n++ {
+			snapshot := newLabelPairs(defaultLabels, []string{fmt.Sprintf("emqx@10.0.0.%d", n), "4.4.19"})
+			for _, desc := range descs {
+				m := &snapshotMetric{desc: desc, valueType: prometheus.GaugeValue, value: 1, labels: snapshot}
+				m.Write(&out)
+			}
+		}
+	}
+}
+
+// BenchmarkEmitSnapshotMetricsLabeled emits metrics with labels of their
+// own, which are merged with the snapshot labels
+func BenchmarkEmitSnapshotMetricsLabeled(b *testing.B) {
+	descs := benchDescs()
+	own := newLabelPairs([]string{"qos"}, []string{"1"})
+	var out dto.Metric
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < benchNodes; n++ {
+			snapshot := newLabelPairs(defaultLabels, []string{fmt.Sprintf("emqx@10.0.0.%d", n), "4.4.19"})
+			for _, desc := range descs {
+				m := &snapshotMetric{desc: desc, valueType: prometheus.GaugeValue, value: 1, labels: mergeLabelPairs(snapshot, own)}
+				m.Write(&out)
+			}
+		}
+	}
+}
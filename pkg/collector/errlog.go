@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// maxSampledErrors bounds the distinct errors tracked by an errorLog,
+// further errors are logged every time
+const maxSampledErrors = 100
+
+// errorLog deduplicates the logs of errors repeated every scrape, e.g.
+// during a broker outage. The first occurrence of an error is logged, then
+// every Nth repetition, and its recovery once a complete scrape passes
+// without it. It is only used by scrape, which is serialized.
+type errorLog struct {
+	every  int
+	errors map[string]*sampledError
+}
+
+type sampledError struct {
+	count int
+	since time.Time
+	// seen is set if the error occurred in the current scrape
+	seen bool
+}
+
+func newErrorLog(every int) *errorLog {
+	return &errorLog{every: every, errors: make(map[string]*sampledError)}
+}
+
+// Error logs err unless it is a repetition which is not sampled
+func (l *errorLog) Error(logger log.Logger, err error) {
+	if l.every <= 1 {
+		logger.Error(err)
+		return
+	}
+
+	msg := err.Error()
+	e, ok := l.errors[msg]
+	if !ok {
+		logger.Error(err)
+		if len(l.errors) < maxSampledErrors {
+			l.errors[msg] = &sampledError{count: 1, since: time.Now(), seen: true}
+		}
+		return
+	}
+	e.count++
+	e.seen = true
+	if e.count%l.every == 0 {
+		logger.Errorf("%s (repeated %d times since %s)", msg, e.count, e.since.Format(time.RFC3339))
+	}
+}
+
+// end closes a scrape, logging the recovery from the errors which did not
+// occur in it if it completed
+func (l *errorLog) end(logger log.Logger, complete bool) {
+	for msg, e := range l.errors {
+		if e.seen {
+			e.seen = false
+			continue
+		}
+		if complete {
+			logger.Infof("Recovered after %d occurrences since %s of: %s", e.count, e.since.Format(time.RFC3339), msg)
+			delete(l.errors, msg)
+		}
+	}
+}
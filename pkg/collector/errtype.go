@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+)
+
+// scrapeErrorTypes are the values of the type label of
+// emq_exporter_last_scrape_error
+var scrapeErrorTypes = []string{"timeout", "auth", "dns", "status_5xx", "decode", "throttled", "other"}
+
+// authErrorCodes are the API result codes rejecting the credentials
+var authErrorCodes = map[int]bool{103: true, 104: true, 105: true}
+
+// classifyError returns the type of a failed scrape, one of scrapeErrorTypes
+func classifyError(err error) string {
+	switch e := err.(type) {
+	case *emqapi.AuthError:
+		return "auth"
+	case *emqapi.DecodeError:
+		return "decode"
+	case *emqapi.ThrottledError:
+		return "throttled"
+	case *emqapi.StatusError:
+		if e.Code >= http.StatusInternalServerError {
+			return "status_5xx"
+		}
+	case *emqapi.RequestError:
+		return classifyRequestError(e.Err)
+	}
+	return "other"
+}
+
+// classifyRequestError returns the type of an error of the HTTP client
+func classifyRequestError(err error) string {
+	timeout := false
+	if e, ok := err.(*url.Error); ok {
+		timeout = e.Timeout()
+		err = e.Err
+	}
+	if e, ok := err.(*net.OpError); ok {
+		err = e.Err
+	}
+	if _, ok := err.(*net.DNSError); ok {
+		return "dns"
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() || timeout || err == context.DeadlineExceeded {
+		return "timeout"
+	}
+	return "other"
+}
+
+// setScrapeError sets emq_exporter_last_scrape_error to the type of the
+// failed scrape, or clears it if typ is empty
+func (c *Collector) setScrapeError(typ string) {
+	for _, t := range scrapeErrorTypes {
+		value := 0.0
+		if t == typ {
+			value = 1
+		}
+		c.lastScrapeError.WithLabelValues(t).Set(value)
+	}
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// ExhookFetcher is implemented by the fetchers able to fetch the gRPC
+// servers of the exhook extension and their hooks
+type ExhookFetcher interface {
+	Exhooks(ctx context.Context) (emqapi.ExhooksResponse, error)
+	ExhookHooks(ctx context.Context, server string) (emqapi.ExhookHooksResponse, error)
+}
+
+var _ ExhookFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	exhookServerUpDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "exhook", "server_up"),
+		"Whether the EMQ node is connected to the enabled exhook gRPC server.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "server"}, nil,
+	)
+	exhookServerCallsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "exhook", "server_calls_total"),
+		"Number of hook invocations the EMQ node sent to the exhook gRPC server, by result. Events of failed invocations are dropped.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "server", "result"}, nil,
+	)
+	exhookHookCallsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "exhook", "hook_calls_total"),
+		"Number of invocations of a hook the EMQ node sent to the exhook gRPC server, by hook and result.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "server", "hook", "result"}, nil,
+	)
+)
+
+// exhookConnected is the status of exhook servers the node is connected to
+const exhookConnected = "connected"
+
+// nodeExhookMetrics returns the metrics of node if they are reported, the
+// metrics of the cluster otherwise
+func nodeExhookMetrics(node string, cluster emqapi.ExhookMetrics, nodes []emqapi.ExhookNodeMetrics) emqapi.ExhookMetrics {
+	for _, n := range nodes {
+		if n.Node == node {
+			return n.Metrics
+		}
+	}
+	return cluster
+}
+
+// collectExhooks sends the status and invocation counters of the exhook
+// servers, failures are logged without marking the node as down
+func (c *Collector) collectExhooks(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(ExhookFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("exhooks") {
+		return
+	}
+	servers, err := fetcher.Exhooks(ctx)
+	c.caps.record("exhooks", err)
+	if err != nil {
+		c.optionalError(logger, err)
+		return
+	}
+	if servers.Code != 0 {
+		c.recordAPIError(logger, "exhooks", servers.Code)
+		return
+	}
+	c.markSuccess("exhooks")
+
+	node := c.client.Node()
+	for _, server := range servers.Result {
+		if !server.Enable {
+			continue
+		}
+		status := server.Status
+		for _, s := range server.NodeStatus {
+			if s.Node == node {
+				status = s.Status
+			}
+		}
+		up := 0.0
+		if status == exhookConnected {
+			up = 1
+		}
+		serverLabels := mergeLabelPairs(labels, newLabelPairs([]string{"server"}, []string{server.Name}))
+		ch <- &snapshotMetric{
+			desc:      exhookServerUpDesc,
+			valueType: prometheus.GaugeValue,
+			value:     up,
+			labels:    serverLabels,
+		}
+		sendExhookCalls(ch, exhookServerCallsDesc, serverLabels, nodeExhookMetrics(node, server.Metrics, server.NodeMetrics))
+
+		hooks, err := fetcher.ExhookHooks(ctx, server.Name)
+		if err != nil {
+			c.optionalError(logger, err)
+			continue
+		}
+		if hooks.Code != 0 {
+			c.recordAPIError(logger, "exhook_hooks", hooks.Code)
+			continue
+		}
+		for _, hook := range hooks.Result {
+			hookLabels := mergeLabelPairs(serverLabels, newLabelPairs([]string{"hook"}, []string{hook.Name}))
+			sendExhookCalls(ch, exhookHookCallsDesc, hookLabels, nodeExhookMetrics(node, hook.Metrics, hook.NodeMetrics))
+		}
+	}
+}
+
+// sendExhookCalls sends the succeeded and failed invocations of metrics
+func sendExhookCalls(ch chan<- prometheus.Metric, desc *prometheus.Desc, labels []*dto.LabelPair, metrics emqapi.ExhookMetrics) {
+	for result, value := range map[string]int64{"succeed": metrics.Succeed, "failed": metrics.Failed} {
+		ch <- &snapshotMetric{
+			desc:      desc,
+			valueType: prometheus.CounterValue,
+			value:     float64(value),
+			labels:    mergeLabelPairs(labels, newLabelPairs([]string{"result"}, []string{result})),
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labeledFamily merges several metrics into one family told apart by labels
+type labeledFamily struct {
+	Name   string
+	Help   string
+	Labels []string
+	// Members maps the names of the merged metrics to their label values
+	Members map[string][]string
+}
+
+// directionFamilies merge the sent and received counters of the metrics endpoint
+var directionFamilies = []labeledFamily{
+	{
+		Name:   "emq_metric_bytes_total",
+		Help:   "Number of bytes sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_sent_bytes_total":     {"sent"},
+			"emq_metric_received_bytes_total": {"received"},
+		},
+	},
+	{
+		Name:   "emq_metric_packets_total",
+		Help:   "Number of MQTT packets sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_packets_sent_total":     {"sent"},
+			"emq_metric_packets_received_total": {"received"},
+		},
+	},
+	{
+		Name:   "emq_metric_packets_publish_total",
+		Help:   "Number of PUBLISH packets sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_packets_publish_sent_total":     {"sent"},
+			"emq_metric_packets_publish_received_total": {"received"},
+		},
+	},
+	{
+		Name:   "emq_metric_packets_puback_total",
+		Help:   "Number of PUBACK packets sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_packets_puback_sent_total":     {"sent"},
+			"emq_metric_packets_puback_received_total": {"received"},
+		},
+	},
+	{
+		Name:   "emq_metric_packets_pubrec_total",
+		Help:   "Number of PUBREC packets sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_packets_pubrec_sent_total":     {"sent"},
+			"emq_metric_packets_pubrec_received_total": {"received"},
+		},
+	},
+	{
+		Name:   "emq_metric_packets_pubrel_total",
+		Help:   "Number of PUBREL packets sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_packets_pubrel_sent_total":     {"sent"},
+			"emq_metric_packets_pubrel_received_total": {"received"},
+		},
+	},
+	{
+		Name:   "emq_metric_packets_pubcomp_total",
+		Help:   "Number of PUBCOMP packets sent and received by the EMQ node, by direction.",
+		Labels: []string{"direction"},
+		Members: map[string][]string{
+			"emq_metric_packets_pubcomp_sent_total":     {"sent"},
+			"emq_metric_packets_pubcomp_received_total": {"received"},
+		},
+	},
+}
+
+// qosFamilies merge the message counters of the QoS levels
+var qosFamilies = []labeledFamily{
+	{
+		Name:   "emq_metric_messages_total",
+		Help:   "Number of messages sent and received by the EMQ node, by QoS level and direction.",
+		Labels: []string{"qos", "direction"},
+		Members: map[string][]string{
+			"emq_metric_messages_qos0_sent_total":     {"0", "sent"},
+			"emq_metric_messages_qos0_received_total": {"0", "received"},
+			"emq_metric_messages_qos1_sent_total":     {"1", "sent"},
+			"emq_metric_messages_qos1_received_total": {"1", "received"},
+			"emq_metric_messages_qos2_sent_total":     {"2", "sent"},
+			"emq_metric_messages_qos2_received_total": {"2", "received"},
+		},
+	},
+}
+
+// labelFamilies replaces the members of the families by labeled metrics of
+// the family, keeping their values
+func labelFamilies(infos *metricInfos, metrics []*metric, families []labeledFamily) []*metric {
+	type member struct {
+		desc  *prometheus.Desc
+		pairs []*dto.LabelPair
+	}
+	members := make(map[string]member)
+	for _, f := range families {
+		// the members are counters, the families only merge current names
+		desc := infos.newDesc(f.Name, f.Help, prometheus.CounterValue, append(append([]string{}, defaultLabels...), f.Labels...), nil)
+		for name, values := range f.Members {
+			members[name] = member{desc: desc, pairs: newLabelPairs(f.Labels, values)}
+		}
+	}
+
+	labeled := make([]*metric, 0, len(metrics))
+	for _, m := range metrics {
+		info, ok := infos.lookup(m.Desc)
+		if !ok {
+			labeled = append(labeled, m)
+			continue
+		}
+		mb, ok := members[info.Name]
+		if !ok {
+			labeled = append(labeled, m)
+			continue
+		}
+		labeled = append(labeled, &metric{
+			Type:       m.Type,
+			Desc:       mb.desc,
+			Value:      m.Value,
+			Present:    m.Present,
+			labelPairs: mb.pairs,
+		})
+	}
+	return labeled
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// GatewaysFetcher is implemented by the fetchers able to fetch the
+// multi-protocol gateways of the node
+type GatewaysFetcher interface {
+	Gateways(ctx context.Context) (emqapi.GatewaysResponse, error)
+}
+
+var _ GatewaysFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	gatewayRunningDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "gateway", "running"),
+		"Whether the multi-protocol gateway of the EMQ broker is running.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "gateway"}, nil,
+	)
+	gatewayClientsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "gateway", "clients"),
+		"Number of clients connected to the multi-protocol gateway of the EMQ broker.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "gateway"}, nil,
+	)
+	gatewayMaxClientsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "gateway", "max_clients"),
+		"Maximum number of clients of the multi-protocol gateway of the EMQ broker.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "gateway"}, nil,
+	)
+	gatewayMessagesDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "gateway", "messages_total"),
+		"Number of messages of the clients of the multi-protocol gateway of the EMQ broker, by direction, received, sent or dropped.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "gateway", "direction"}, nil,
+	)
+)
+
+// gatewayUnloaded is the status of gateways which are not configured
+const gatewayUnloaded = "unloaded"
+
+// collectGateways sends the clients and message counters of the loaded
+// gateways, failures are logged without marking the node as down
+func (c *Collector) collectGateways(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(GatewaysFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("gateways") {
+		return
+	}
+	gateways, err := fetcher.Gateways(ctx)
+	c.caps.record("gateways", err)
+	if err != nil {
+		c.optionalError(logger, err)
+		return
+	}
+	if gateways.Code != 0 {
+		c.recordAPIError(logger, "gateways", gateways.Code)
+		return
+	}
+	c.markSuccess("gateways")
+
+	for _, gateway := range gateways.Result {
+		if gateway.Status == gatewayUnloaded {
+			continue
+		}
+		gatewayLabels := mergeLabelPairs(labels, newLabelPairs([]string{"gateway"}, []string{gateway.Name}))
+		running := 0.0
+		if gateway.Status == "running" {
+			running = 1
+		}
+		ch <- &snapshotMetric{
+			desc:      gatewayRunningDesc,
+			valueType: prometheus.GaugeValue,
+			value:     running,
+			labels:    gatewayLabels,
+		}
+		if gateway.CurrentConnections != nil {
+			ch <- &snapshotMetric{
+				desc:      gatewayClientsDesc,
+				valueType: prometheus.GaugeValue,
+				value:     float64(*gateway.CurrentConnections),
+				labels:    gatewayLabels,
+			}
+		}
+		if gateway.MaxConnections != nil {
+			ch <- &snapshotMetric{
+				desc:      gatewayMaxClientsDesc,
+				valueType: prometheus.GaugeValue,
+				value:     float64(*gateway.MaxConnections),
+				labels:    gatewayLabels,
+			}
+		}
+
+		messages := map[string]*int64{
+			"received": gateway.Metrics.MessagesReceived,
+			"sent":     gateway.Metrics.MessagesSent,
+			"dropped":  gateway.Metrics.MessagesDropped,
+		}
+		for direction, value := range messages {
+			if value == nil {
+				continue
+			}
+			ch <- &snapshotMetric{
+				desc:      gatewayMessagesDesc,
+				valueType: prometheus.CounterValue,
+				value:     float64(*value),
+				labels:    mergeLabelPairs(gatewayLabels, newLabelPairs([]string{"direction"}, []string{direction})),
+			}
+		}
+	}
+}
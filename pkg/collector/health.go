@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"time"
+)
+
+// Health is the outcome of the last finished scrape of a collector
+type Health struct {
+	Node       string
+	LastScrape time.Time
+	Duration   time.Duration
+	Up         bool
+	LastError  string
+	// ErrorType classifies LastError, see emq_exporter_last_scrape_error
+	ErrorType  string
+	APIVersion string
+}
+
+// Health returns the outcome of the last finished scrape, the zero Health
+// if the collector has not been scraped yet
+func (c *Collector) Health() Health {
+	c.healthMtx.Lock()
+	defer c.healthMtx.Unlock()
+	return c.health
+}
+
+func (c *Collector) setHealth(h Health) {
+	c.healthMtx.Lock()
+	defer c.healthMtx.Unlock()
+	c.health = h
+}
@@ -0,0 +1,49 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Inherit takes over the exporter metrics of prev, the collector of the same
+// node built from the previous configuration, so the counters about the
+// exporter do not start over on reload. It must be called before c is used.
+func (c *Collector) Inherit(prev *Collector) {
+	c.up = prev.up
+	c.totalScrapes = prev.totalScrapes
+	c.jsonParseFailures = prev.jsonParseFailures
+	c.cachedScrapes = prev.cachedScrapes
+	c.coalescedScrapes = prev.coalescedScrapes
+	c.scrapeDuration = prev.scrapeDuration
+	c.authFailures = prev.authFailures
+	c.throttled = prev.throttled
+	c.dnsFailures = prev.dnsFailures
+	c.counterResets = prev.counterResets
+	c.apiErrors = prev.apiErrors
+	c.lastSuccess = prev.lastSuccess
+	c.requestDuration = prev.requestDuration
+	c.responseBytes = prev.responseBytes
+	c.servingURL = prev.servingURL
+	c.missingFields = prev.missingFields
+	c.unknownFields = prev.unknownFields
+	c.lastScrapeError = prev.lastScrapeError
+	c.servingStale = prev.servingStale
+	c.nodeNameMismatch = prev.nodeNameMismatch
+	c.deprecatedScraped = prev.deprecatedScraped
+
+	// the metadata of the inherited metrics is kept by prev
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.describeExporter(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		if info, ok := prev.infos.lookup(desc); ok {
+			c.infos.record(desc, info)
+		}
+	}
+
+	prev.healthMtx.Lock()
+	c.health = prev.health
+	prev.healthMtx.Unlock()
+
+	// the deprecated metrics are found by the descriptors of the current ones
+	c.setupDeprecated()
+}
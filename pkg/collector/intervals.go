@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// intervalRun is the last run of an optional collector with an interval
+type intervalRun struct {
+	at      time.Time
+	metrics []prometheus.Metric
+}
+
+// every runs collect, which sends the metrics of the named optional
+// collector, at most once per its configured interval and sends the
+// metrics of the last run in between, e.g. to list the clients every 5
+// minutes while the stats are scraped every 15 seconds. Runs without
+// metrics, e.g. failed ones, are retried at the next scrape. It is only
+// used by scrapes, which never run concurrently.
+func (c *Collector) every(name string, ch chan<- prometheus.Metric, collect func(ch chan<- prometheus.Metric)) {
+	interval := c.intervals[name]
+	if interval <= 0 {
+		collect(ch)
+		return
+	}
+	if last, ok := c.intervalRuns[name]; ok && time.Since(last.at) < interval {
+		for _, m := range last.metrics {
+			ch <- m
+		}
+		return
+	}
+
+	metricCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for m := range metricCh {
+			metrics = append(metrics, m)
+			ch <- m
+		}
+		close(done)
+	}()
+	collect(metricCh)
+	close(metricCh)
+	<-done
+
+	if len(metrics) == 0 {
+		delete(c.intervalRuns, name)
+		return
+	}
+	c.intervalRuns[name] = &intervalRun{at: time.Now(), metrics: metrics}
+}
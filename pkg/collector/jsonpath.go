@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupJSONPath resolves a gjson style dotted path such as "result.load1"
+// against a decoded JSON document and returns the value as a float.
+// Array elements are addressed by index, "#" yields the length of an
+// array and dots inside keys can be escaped with a backslash.
+func lookupJSONPath(data interface{}, path string) (float64, error) {
+	cur := data
+	for _, key := range splitJSONPath(path) {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return 0, fmt.Errorf("key %q not found in path %q", key, path)
+			}
+			cur = next
+		case []interface{}:
+			if key == "#" {
+				cur = float64(len(v))
+				continue
+			}
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return 0, fmt.Errorf("invalid array index %q in path %q", key, path)
+			}
+			cur = v[i]
+		default:
+			return 0, fmt.Errorf("cannot descend into %q in path %q", key, path)
+		}
+	}
+
+	switch v := cur.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("value %q at path %q is not a number", v, path)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("value at path %q is not a number", path)
+	}
+}
+
+func splitJSONPath(path string) []string {
+	var (
+		keys []string
+		key  strings.Builder
+	)
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			key.WriteByte(path[i])
+		case path[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+	return append(keys, key.String())
+}
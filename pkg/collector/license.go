@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// LicenseFetcher is implemented by the fetchers able to fetch the license
+// of enterprise brokers
+type LicenseFetcher interface {
+	License(ctx context.Context) (emqapi.LicenseResponse, error)
+}
+
+var _ LicenseFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	licenseExpiryDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "license", "expiry_timestamp_seconds"),
+		"Time the license of the EMQ broker expires, in seconds since the epoch.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+	licenseMaxConnectionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "license", "max_connections"),
+		"Number of connections allowed by the license of the EMQ broker.",
+		prometheus.GaugeValue,
+		defaultLabels, nil,
+	)
+)
+
+// collectLicense sends the license metrics of enterprise brokers, failures
+// are logged without marking the node as down
+func (c *Collector) collectLicense(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(LicenseFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("license") {
+		return
+	}
+	license, err := fetcher.License(ctx)
+	c.caps.record("license", err)
+	if err != nil {
+		c.optionalError(logger, err)
+		return
+	}
+	if license.Code != 0 {
+		c.recordAPIError(logger, "license", license.Code)
+		return
+	}
+	c.markSuccess("license")
+
+	ch <- &snapshotMetric{
+		desc:      licenseMaxConnectionsDesc,
+		valueType: prometheus.GaugeValue,
+		value:     float64(license.Result.MaxConnections),
+		labels:    labels,
+	}
+	expiry, err := parseBrokerTime(license.Result.ExpiryAt)
+	if err != nil {
+		c.errorLog.Error(logger, fmt.Errorf("cannot parse the license expiry %q: %s", license.Result.ExpiryAt, err))
+		return
+	}
+	ch <- &snapshotMetric{
+		desc:      licenseExpiryDesc,
+		valueType: prometheus.GaugeValue,
+		value:     float64(expiry.Unix()),
+		labels:    labels,
+	}
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// ListenersFetcher is implemented by the fetchers able to fetch the
+// protocol listeners of the node
+type ListenersFetcher interface {
+	Listeners(ctx context.Context) (emqapi.ListenersResponse, error)
+}
+
+var _ ListenersFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	listenerConnectionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "listener", "connections"),
+		"Number of connections to the listener of the EMQ node.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "protocol", "listen_on"}, nil,
+	)
+	listenerMaxConnectionsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "listener", "max_connections"),
+		"Maximum number of connections to the listener of the EMQ node.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "protocol", "listen_on"}, nil,
+	)
+	listenerMaxConnectionRateDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "listener", "max_connection_rate"),
+		"Limit of the connection rate limiter of the listener of the EMQ node, in connections per second.",
+		prometheus.GaugeValue,
+		[]string{"node", "version", "protocol", "listen_on"}, nil,
+	)
+	listenerShutdownsDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "listener", "shutdowns_total"),
+		"Number of connections to the listener of the EMQ node closed by the broker, by reason, including the connections rejected by the connection rate limiter.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "protocol", "listen_on", "reason"}, nil,
+	)
+)
+
+// collectListeners sends the connections, limits and shutdowns of the
+// listeners, failures are logged without marking the node as down
+func (c *Collector) collectListeners(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(ListenersFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("listeners") {
+		return
+	}
+	listeners, err := fetcher.Listeners(ctx)
+	c.caps.record("listeners", err)
+	if err != nil {
+		c.optionalError(logger, err)
+		return
+	}
+	if listeners.Code != 0 {
+		c.recordAPIError(logger, "listeners", listeners.Code)
+		return
+	}
+	c.markSuccess("listeners")
+
+	for _, l := range listeners.Result {
+		listenerLabels := mergeLabelPairs(labels, newLabelPairs([]string{"protocol", "listen_on"}, []string{l.Protocol, l.ListenOn}))
+		ch <- &snapshotMetric{
+			desc:      listenerConnectionsDesc,
+			valueType: prometheus.GaugeValue,
+			value:     float64(l.CurrentConns),
+			labels:    listenerLabels,
+		}
+		ch <- &snapshotMetric{
+			desc:      listenerMaxConnectionsDesc,
+			valueType: prometheus.GaugeValue,
+			value:     float64(l.MaxConns),
+			labels:    listenerLabels,
+		}
+		if l.MaxConnRate != nil {
+			ch <- &snapshotMetric{
+				desc:      listenerMaxConnectionRateDesc,
+				valueType: prometheus.GaugeValue,
+				value:     *l.MaxConnRate,
+				labels:    listenerLabels,
+			}
+		}
+		for reason, count := range l.ShutdownCount {
+			ch <- &snapshotMetric{
+				desc:      listenerShutdownsDesc,
+				valueType: prometheus.CounterValue,
+				value:     float64(count),
+				labels:    mergeLabelPairs(listenerLabels, newLabelPairs([]string{"reason"}, []string{reason})),
+			}
+		}
+	}
+}
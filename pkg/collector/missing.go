@@ -0,0 +1,30 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+// countMissingField records a field of an endpoint response which was
+// missing or could not be parsed
+func (c *Collector) countMissingField(logger log.Logger, field, endpoint string, err error) {
+	c.missingFields.WithLabelValues(field, endpoint).Inc()
+	logger.Debugf("Field %s of the %s endpoint is missing: %s", field, endpoint, err)
+}
+
+// countMissingFields records the optional fields of an endpoint response,
+// the pointer fields of result, which the broker did not return
+func (c *Collector) countMissingFields(logger log.Logger, endpoint string, result interface{}) {
+	v := reflect.ValueOf(result)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() != reflect.Ptr || !v.Field(i).IsNil() {
+			continue
+		}
+		field := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		c.missingFields.WithLabelValues(field, endpoint).Inc()
+		logger.Debugf("Field %s of the %s endpoint is missing", field, endpoint)
+	}
+}
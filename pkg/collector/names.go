@@ -0,0 +1,56 @@
+package collector
+
+// legacyNames maps the current metric names to the names used before unit
+// suffixes were added, which are served when Options.LegacyNames is set
+var legacyNames = map[string]string{
+	"emq_exporter_json_parse_failures_total":    "emq_node_json_parse_failures",
+	"emq_exporter_scrapes_total":                "emq_node_total_scrapes",
+	"emq_metric_messages_dropped_total":         "emq_metric_messages_dropped",
+	"emq_metric_messages_qos0_received_total":   "emq_metric_messages_qos0_received",
+	"emq_metric_messages_qos0_sent_total":       "emq_metric_messages_qos0_sent",
+	"emq_metric_messages_qos1_received_total":   "emq_metric_messages_qos1_received",
+	"emq_metric_messages_qos1_sent_total":       "emq_metric_messages_qos1_sent",
+	"emq_metric_messages_qos2_dropped_total":    "emq_metric_messages_qos2_dropped",
+	"emq_metric_messages_qos2_received_total":   "emq_metric_messages_qos2_received",
+	"emq_metric_messages_qos2_sent_total":       "emq_metric_messages_qos2_sent",
+	"emq_metric_messages_received_total":        "emq_metric_messages_received",
+	"emq_metric_messages_retained_total":        "emq_metric_messages_retained",
+	"emq_metric_messages_sent_total":            "emq_metric_messages_sent",
+	"emq_metric_packets_connack_total":          "emq_metric_packets_connack",
+	"emq_metric_packets_connect_total":          "emq_metric_packets_connect",
+	"emq_metric_packets_disconnect_total":       "emq_metric_packets_disconnected",
+	"emq_metric_packets_pingreq_total":          "emq_metric_packets_pingreq",
+	"emq_metric_packets_pingresp_total":         "emq_metric_packets_pingresp",
+	"emq_metric_packets_puback_missed_total":    "emq_metric_packets_puback_missed",
+	"emq_metric_packets_puback_received_total":  "emq_metric_packets_puback_received",
+	"emq_metric_packets_puback_sent_total":      "emq_metric_packets_puback_sent",
+	"emq_metric_packets_pubcomp_missed_total":   "emq_metric_packets_pubcomp_missed",
+	"emq_metric_packets_pubcomp_received_total": "emq_metric_packets_pubcomp_received",
+	"emq_metric_packets_pubcomp_sent_total":     "emq_metric_packets_pubcomp_sent",
+	"emq_metric_packets_publish_received_total": "emq_metric_packets_publish_received",
+	"emq_metric_packets_publish_sent_total":     "emq_metric_packets_publish_sent",
+	"emq_metric_packets_pubrec_missed_total":    "emq_metric_packets_pubrec_missed",
+	"emq_metric_packets_pubrec_received_total":  "emq_metric_packets_pubrec_received",
+	"emq_metric_packets_pubrec_sent_total":      "emq_metric_packets_pubrec_sent",
+	"emq_metric_packets_pubrel_missed_total":    "emq_metric_packets_pubrel_missed",
+	"emq_metric_packets_pubrel_received_total":  "emq_metric_packets_pubrel_received",
+	"emq_metric_packets_pubrel_sent_total":      "emq_metric_packets_pubrel_sent",
+	"emq_metric_packets_received_total":         "emq_metric_packets_received",
+	"emq_metric_packets_sent_total":             "emq_metric_packets_sent",
+	"emq_metric_packets_suback_total":           "emq_metric_packets_suback",
+	"emq_metric_packets_unsuback_total":         "emq_metric_packets_unsuback",
+	"emq_metric_packets_unsubscribe_total":      "emq_metric_packets_unsubscribe",
+	"emq_metric_received_bytes_total":           "emq_metric_bytes_received",
+	"emq_metric_sent_bytes_total":               "emq_metric_bytes_sent",
+	"emq_node_fds_utilization_ratio":            "emq_node_fds_utilization",
+	"emq_node_memory_total_bytes":               "emq_node_memory_total",
+	"emq_node_memory_used_bytes":                "emq_node_memory_used",
+	"emq_node_process_utilization_ratio":        "emq_node_process_utilization",
+}
+
+// legacyCounters are the old names which were already counters, the other
+// renamed metrics were served as gauges
+var legacyCounters = map[string]bool{
+	"emq_node_json_parse_failures": true,
+	"emq_node_total_scrapes":       true,
+}
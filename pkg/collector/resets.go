@@ -0,0 +1,29 @@
+package collector
+
+// counterState is the last value of a counter of the node and the sum of
+// its values before the resets of the broker
+type counterState struct {
+	last   float64
+	offset float64
+}
+
+// counterValue records the value of a counter of the node, counting a reset
+// when it is lower than at the previous scrape, e.g. after a restart of the
+// broker. With Options.CompensateCounterResets the value is returned
+// increased by the values before the resets, so it keeps rising across
+// restarts. It is only used by scrapes, which never run concurrently.
+func (c *Collector) counterValue(m *metric, value float64) float64 {
+	state, ok := c.counters[m]
+	if !ok {
+		state = &counterState{}
+		c.counters[m] = state
+	} else if value < state.last {
+		c.counterResets.Inc()
+		state.offset += state.last
+	}
+	state.last = value
+	if c.opts.CompensateCounterResets {
+		return value + state.offset
+	}
+	return value
+}
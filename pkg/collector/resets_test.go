@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeFetcher answers every scrape with the next of its received counts
+type fakeFetcher struct {
+	received []int
+}
+
+func (f *fakeFetcher) Node() string { return "emqx@127.0.0.1" }
+
+func (f *fakeFetcher) APIVersion(ctx context.Context) (*emqapi.APIVersion, error) {
+	return emqapi.FindAPIVersion("v4")
+}
+
+func (f *fakeFetcher) Nodes(ctx context.Context) (emqapi.NodesResponse, error) {
+	return emqapi.NodesResponse{}, nil
+}
+
+func (f *fakeFetcher) Metrics(ctx context.Context) (emqapi.MetricsResponse, error) {
+	var resp emqapi.MetricsResponse
+	resp.Result.MessagesReceived = f.received[0]
+	f.received = f.received[1:]
+	return resp, nil
+}
+
+func (f *fakeFetcher) Stats(ctx context.Context) (emqapi.StatsResponse, error) {
+	return emqapi.StatsResponse{}, nil
+}
+
+func (f *fakeFetcher) Management(ctx context.Context) (emqapi.ManagementResponse, error) {
+	var resp emqapi.ManagementResponse
+	resp.Result = []emqapi.ManagementResponseResult{{Name: f.Node()}}
+	return resp, nil
+}
+
+func (f *fakeFetcher) Custom(ctx context.Context, path string) (interface{}, error) {
+	return nil, fmt.Errorf("no custom endpoint %s", path)
+}
+
+func TestCounterResets(t *testing.T) {
+	fetcher := &fakeFetcher{received: []int{100, 40, 50}}
+	c := New(fetcher, &config.Config{}, Options{CompensateCounterResets: true})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	for i, want := range []struct {
+		received, resets float64
+	}{
+		{100, 0},
+		{140, 1},
+		{150, 1},
+	} {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+		got := make(map[string]float64)
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				got[mf.GetName()] = m.GetCounter().GetValue()
+			}
+		}
+		if v := got["emq_metric_messages_received_total"]; v != want.received {
+			t.Errorf("scrape %d: emq_metric_messages_received_total = %v, want %v", i, v, want.received)
+		}
+		if v := got["emq_exporter_counter_resets_total"]; v != want.resets {
+			t.Errorf("scrape %d: emq_exporter_counter_resets_total = %v, want %v", i, v, want.resets)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package collector
+
+import "github.com/larseen/emq_exporter/pkg/emqapi"
+
+type combinedResponse struct {
+	nodes       emqapi.NodesResponse
+	metrics     emqapi.MetricsResponse
+	stats       emqapi.StatsResponse
+	ClusterSize int
+	// ClusterVersions is the number of distinct versions of the nodes
+	ClusterVersions int
+}
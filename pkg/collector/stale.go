@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// staleResponse is the last good scrape of a node, persisted to serve it
+// while the node is unreachable
+type staleResponse struct {
+	Saved           time.Time              `json:"saved"`
+	Version         string                 `json:"version"`
+	Nodes           emqapi.NodesResponse   `json:"nodes"`
+	Metrics         emqapi.MetricsResponse `json:"metrics"`
+	Stats           emqapi.StatsResponse   `json:"stats"`
+	ClusterSize     int                    `json:"cluster_size"`
+	ClusterVersions int                    `json:"cluster_versions"`
+}
+
+func (r *staleResponse) values() combinedResponse {
+	return combinedResponse{r.Nodes, r.Metrics, r.Stats, r.ClusterSize, r.ClusterVersions}
+}
+
+// saveStale persists a good scrape to the stale cache file, replacing the
+// previous one atomically
+func (c *Collector) saveStale(logger log.Logger, values combinedResponse, version string) {
+	if c.opts.StaleCacheFile == "" {
+		return
+	}
+	c.stale = &staleResponse{
+		Saved:           time.Now(),
+		Version:         version,
+		Nodes:           values.nodes,
+		Metrics:         values.metrics,
+		Stats:           values.stats,
+		ClusterSize:     values.ClusterSize,
+		ClusterVersions: values.ClusterVersions,
+	}
+
+	b, err := json.Marshal(c.stale)
+	if err != nil {
+		logger.Errorf("Failed to encode the stale cache: %s", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.opts.StaleCacheFile), ".emq_exporter_stale")
+	if err != nil {
+		logger.Errorf("Failed to write the stale cache: %s", err)
+		return
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.opts.StaleCacheFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.Errorf("Failed to write the stale cache %s: %s", c.opts.StaleCacheFile, err)
+	}
+}
+
+// loadStale returns the last good scrape, read from the stale cache file
+// after a restart of the exporter
+func (c *Collector) loadStale(logger log.Logger) *staleResponse {
+	if c.stale != nil || c.staleLoaded {
+		return c.stale
+	}
+	c.staleLoaded = true
+
+	b, err := ioutil.ReadFile(c.opts.StaleCacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Failed to read the stale cache %s: %s", c.opts.StaleCacheFile, err)
+		}
+		return nil
+	}
+	var stale staleResponse
+	if err := json.Unmarshal(b, &stale); err != nil {
+		logger.Errorf("Failed to decode the stale cache %s: %s", c.opts.StaleCacheFile, err)
+		return nil
+	}
+	c.stale = &stale
+	return c.stale
+}
+
+// serveStale sends the metrics of the last good scrape, if it is recent
+// enough, in place of the ones of a failed scrape
+func (c *Collector) serveStale(logger log.Logger, ch chan<- prometheus.Metric) {
+	if c.opts.StaleCacheFile == "" {
+		return
+	}
+	stale := c.loadStale(logger)
+	if stale == nil || time.Since(stale.Saved) > c.opts.StaleMaxAge {
+		return
+	}
+
+	logger.Warnf("Serving the scrape of %s from %s from the stale cache", c.client.Node(), stale.Saved.Format(time.RFC3339))
+	c.servingStale.Set(1)
+	values := stale.values()
+	snapshot := newLabelPairs(defaultLabels, []string{values.nodes.Result.NodeName, stale.Version})
+	c.emitNodeMetrics(ch, values, snapshot, nil)
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsDescriptions describes the stats families, families without a
+// description fall back to their name
+var statsDescriptions = map[string]string{
+	"channels":            "client channels (connected clients and persistent sessions) of",
+	"clients":             "clients using",
+	"connections":         "network connections to",
+	"retained":            "retained messages in",
+	"routes":              "routes in use by",
+	"sessions":            "sessions in use by",
+	"sessions/persistent": "persistent sessions in use by",
+	"subscribers":         "subscribers using",
+	"subscriptions":       "subscriptions in use by",
+	"topics":              "topics being used in",
+}
+
+// statsSkipped are the stats families exported by dedicated metrics
+var statsSkipped = map[string]bool{
+	"subscriptions/wildcard": true,
+}
+
+// statsMetrics generates a current and a high-watermark gauge for every
+// count/max pair of the stats response, based on its JSON field tags.
+// Pointer fields are optional and only emitted when the broker reports them.
+func statsMetrics(infos *metricInfos) []*metric {
+	var metrics []*metric
+
+	t := reflect.TypeOf(emqapi.StatsResponseResult{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		optional := field.Type.Kind() == reflect.Ptr
+		if optional && field.Type.Elem().Kind() != reflect.Int || !optional && field.Type.Kind() != reflect.Int {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		sep := strings.LastIndex(tag, "/")
+		if sep < 0 {
+			continue
+		}
+		family, kind := tag[:sep], tag[sep+1:]
+		if statsSkipped[family] {
+			continue
+		}
+		name := strings.Replace(family, "/", "_", -1)
+
+		description, ok := statsDescriptions[family]
+		if !ok {
+			description = strings.Replace(family, "/", " ", -1) + " in"
+		}
+
+		var help string
+		switch kind {
+		case "count":
+			help = "Number of " + description + " the EMQ node."
+		case "max":
+			name += "_max"
+			help = "Highest number of " + description + " the EMQ node since it started."
+		default:
+			continue
+		}
+
+		index := i
+		m := &metric{
+			Type: prometheus.GaugeValue,
+			Desc: infos.newDesc(
+				prometheus.BuildFQName(Namespace, "stats", name),
+				help,
+				prometheus.GaugeValue,
+				defaultLabels, nil,
+			),
+			Value: func(values combinedResponse) float64 {
+				return float64(reflect.Indirect(reflect.ValueOf(values.stats.Result).Field(index)).Int())
+			},
+		}
+		if optional {
+			m.Present = func(values combinedResponse) bool {
+				return !reflect.ValueOf(values.stats.Result).Field(index).IsNil()
+			}
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
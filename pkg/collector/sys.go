@@ -0,0 +1,323 @@
+package collector
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/larseen/emq_exporter/pkg/mqtt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// sysTopicPrefix is the prefix of the topics the brokers publish their
+// statistics to, followed by the node name
+const sysTopicPrefix = "$SYS/brokers/"
+
+// sysBrokerInfoName is the name of the info metric of the brokers
+var sysBrokerInfoName = prometheus.BuildFQName(Namespace, "sys", "broker_info")
+
+// sysRetry is the delay before the subscription is retried after a failure
+const sysRetry = 5 * time.Second
+
+// SysOptions configures the subscription to the $SYS topics
+type SysOptions struct {
+	mqtt.Options
+	// Expiry is how long the values of a node are served after the last
+	// message of the node, so nodes leaving the cluster disappear
+	Expiry time.Duration
+	// Mappings are tried before DefaultSysMappings
+	Mappings []config.SysMappingConfig
+	// PayloadSizeFilters are topic filters of application messages, e.g. a
+	// shared subscription, which are subscribed to observe the size of
+	// their payloads
+	PayloadSizeFilters []string
+}
+
+// sysSample is the last value published to a $SYS topic
+type sysSample struct {
+	name      string
+	help      string
+	valueType dto.MetricType
+	labels    []*dto.LabelPair
+	value     float64
+	updated   time.Time
+}
+
+// sysNode are the descriptive topics of a node, exported together as info
+type sysNode struct {
+	version  string
+	sysdescr string
+	updated  time.Time
+}
+
+// SysSource exports the statistics the EMQ brokers publish to their $SYS
+// topics over MQTT, for clusters whose HTTP API is disabled or not reachable
+type SysSource struct {
+	url      *url.URL
+	opts     SysOptions
+	mappings []*sysMapping
+	payloads *payloadSizes
+
+	mtx sync.Mutex
+	// samples are keyed by metric name and node
+	samples map[string]*sysSample
+	nodes   map[string]*sysNode
+	clients *clientEvents
+
+	infos    *metricInfos
+	registry *prometheus.Registry
+	up       prometheus.Gauge
+	messages prometheus.Counter
+	invalid  prometheus.Counter
+}
+
+// NewSysSource returns a source subscribing to the $SYS topics of the broker at u
+func NewSysSource(u *url.URL, opts SysOptions) (*SysSource, error) {
+	if err := opts.Options.Validate(); err != nil {
+		return nil, err
+	}
+	mappings, err := compileSysMappings(append(opts.Mappings, DefaultSysMappings...))
+	if err != nil {
+		return nil, err
+	}
+	infos := newMetricInfos()
+	s := &SysSource{
+		url:      u,
+		opts:     opts,
+		mappings: mappings,
+		samples:  make(map[string]*sysSample),
+		nodes:    make(map[string]*sysNode),
+		infos:    infos,
+		clients:  newClientEvents(infos),
+		payloads: newPayloadSizes(infos, opts.PayloadSizeFilters),
+		registry: prometheus.NewRegistry(),
+		up: infos.newGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(Namespace, "sys", "up"),
+			Help: "Whether the exporter is subscribed to the $SYS topics of the EMQ broker.",
+		}),
+		messages: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "sys", "messages_received_total"),
+			Help: "Number of messages received on the $SYS topics.",
+		}),
+		invalid: infos.newCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "sys", "invalid_messages_total"),
+			Help: "Number of messages received on the $SYS topics which could not be converted to a metric.",
+		}),
+	}
+	s.registry.MustRegister(s.up, s.messages, s.invalid)
+	s.registry.MustRegister(s.clients.collectors()...)
+	if len(opts.PayloadSizeFilters) > 0 {
+		s.registry.MustRegister(s.payloads.sizes)
+	}
+	return s, nil
+}
+
+// sysMetricNames returns the names of the metrics of the $SYS source, with
+// the captures of the default mappings
+func sysMetricNames() []string {
+	s, err := NewSysSource(nil, SysOptions{})
+	if err != nil {
+		return nil
+	}
+	names := append(s.infos.names(), sysBrokerInfoName)
+	for _, m := range DefaultSysMappings {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// Run subscribes to the $SYS topics until ctx is done, subscribing again
+// whenever the connection fails
+func (s *SysSource) Run(ctx context.Context) {
+	filters := append([]string{sysTopicPrefix + "#"}, s.opts.PayloadSizeFilters...)
+	for {
+		err := mqtt.Subscribe(ctx, s.url, s.opts.Options, filters, func(msg mqtt.Message) {
+			s.up.Set(1)
+			s.handle(msg)
+		})
+		s.up.Set(0)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Errorf("Subscription to the $SYS topics of %s failed: %s, retrying in %s", s.url.Host, err, sysRetry)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sysRetry):
+		}
+	}
+}
+
+// handle records the value of a $SYS message, or the payload size of a
+// message received on a payload size filter
+func (s *SysSource) handle(msg mqtt.Message) {
+	if !strings.HasPrefix(msg.Topic, "$SYS/") && s.payloads.handle(msg.Topic, msg.Payload) {
+		return
+	}
+	s.messages.Inc()
+	if !strings.HasPrefix(msg.Topic, sysTopicPrefix) {
+		return
+	}
+	levels := strings.Split(strings.TrimPrefix(msg.Topic, sysTopicPrefix), "/")
+	if len(levels) < 2 {
+		return
+	}
+	node, levels := levels[0], levels[1:]
+	payload := strings.TrimSpace(string(msg.Payload))
+	now := time.Now()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	info, ok := s.nodes[node]
+	if !ok {
+		info = &sysNode{}
+		s.nodes[node] = info
+	}
+	info.updated = now
+
+	if ok, err := s.clients.handle(node, levels, msg.Payload); ok {
+		if err != nil {
+			s.invalid.Inc()
+		}
+		return
+	}
+
+	switch levels[0] {
+	case "version":
+		info.version = payload
+		return
+	case "sysdescr":
+		info.sysdescr = payload
+		return
+	}
+
+	for _, m := range s.mappings {
+		captures, ok := m.match(levels)
+		if !ok {
+			continue
+		}
+		value, err := m.parse(payload)
+		if err != nil {
+			s.invalid.Inc()
+			return
+		}
+
+		names := []string{"node"}
+		values := []string{node}
+		for name, template := range m.labels {
+			names = append(names, name)
+			values = append(values, expandCaptures(template, captures))
+		}
+		sample := &sysSample{
+			name:      invalidNameChars.ReplaceAllString(expandCaptures(m.name, captures), "_"),
+			help:      m.help,
+			valueType: m.valueType,
+			labels:    newLabelPairs(names, values),
+			value:     value,
+			updated:   now,
+		}
+		s.samples[sampleKey(sample)] = sample
+		return
+	}
+}
+
+// sampleKey identifies the series of a sample, topics differing only in
+// characters invalid in names share a series
+func sampleKey(sample *sysSample) string {
+	key := sample.name
+	for _, l := range sample.labels {
+		key += "|" + l.GetName() + "=" + l.GetValue()
+	}
+	return key
+}
+
+// Gather implements prometheus.Gatherer
+func (s *SysSource) Gather() ([]*dto.MetricFamily, error) {
+	result, err := s.registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	expired := time.Now().Add(-s.opts.Expiry)
+	families := make(map[string]*dto.MetricFamily)
+	for key, sample := range s.samples {
+		if s.opts.Expiry > 0 && sample.updated.Before(expired) {
+			delete(s.samples, key)
+			continue
+		}
+		mf, ok := families[sample.name]
+		if !ok {
+			mf = &dto.MetricFamily{
+				Name: proto.String(sample.name),
+				Help: proto.String(sample.help),
+				Type: sample.valueType.Enum(),
+			}
+			families[sample.name] = mf
+		} else if mf.GetType() != sample.valueType {
+			continue
+		}
+		m := &dto.Metric{Label: sample.labels}
+		switch sample.valueType {
+		case dto.MetricType_COUNTER:
+			m.Counter = &dto.Counter{Value: proto.Float64(sample.value)}
+		case dto.MetricType_GAUGE:
+			m.Gauge = &dto.Gauge{Value: proto.Float64(sample.value)}
+		default:
+			m.Untyped = &dto.Untyped{Value: proto.Float64(sample.value)}
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+
+	info := &dto.MetricFamily{
+		Name: proto.String(sysBrokerInfoName),
+		Help: proto.String("Description of the EMQ broker from its $SYS topics, the value is always 1."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for node, n := range s.nodes {
+		if s.opts.Expiry > 0 && n.updated.Before(expired) {
+			delete(s.nodes, node)
+			continue
+		}
+		info.Metric = append(info.Metric, &dto.Metric{
+			Label: newLabelPairs([]string{"node", "version", "sysdescr"}, []string{node, n.version, n.sysdescr}),
+			Gauge: &dto.Gauge{Value: proto.Float64(1)},
+		})
+	}
+	if len(info.Metric) > 0 {
+		families[info.GetName()] = info
+	}
+
+	for _, mf := range families {
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsLess(mf.Metric[i].Label, mf.Metric[j].Label)
+		})
+		result = append(result, mf)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, nil
+}
+
+// labelsLess orders metrics by their sorted label pairs
+func labelsLess(a, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetName() != b[i].GetName() {
+			return a[i].GetName() < b[i].GetName()
+		}
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxDisconnectReasons bounds the reason label values of a node, further
+// reasons are counted as other
+const maxDisconnectReasons = 20
+
+// clientEvents counts the client connected and disconnected events the
+// brokers publish to $SYS/brokers/<node>/clients/<clientid>/
+type clientEvents struct {
+	connected    *prometheus.CounterVec
+	disconnected *prometheus.CounterVec
+	abnormal     *prometheus.CounterVec
+	// reasons are the reason label values seen by node
+	reasons map[string]map[string]bool
+}
+
+func newClientEvents(infos *metricInfos) *clientEvents {
+	return &clientEvents{
+		connected: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "sys", "client_connected_total"),
+			Help: "Number of clients connected to the EMQ node, from its $SYS client events.",
+		}, []string{"node"}),
+		disconnected: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "sys", "client_disconnected_total"),
+			Help: "Number of clients disconnected from the EMQ node by reason, from its $SYS client events.",
+		}, []string{"node", "reason"}),
+		abnormal: infos.newCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(Namespace, "sys", "client_abnormal_disconnects_total"),
+			Help: "Number of clients disconnected from the EMQ node without a DISCONNECT packet, which publishes their last will.",
+		}, []string{"node"}),
+		reasons: make(map[string]map[string]bool),
+	}
+}
+
+// handle counts the event if levels, below the node, are a client event
+// topic, and reports whether they were
+func (e *clientEvents) handle(node string, levels []string, payload []byte) (bool, error) {
+	// client IDs may contain slashes
+	if len(levels) < 3 || levels[0] != "clients" {
+		return false, nil
+	}
+	switch levels[len(levels)-1] {
+	case "connected":
+		e.connected.WithLabelValues(node).Inc()
+		return true, nil
+	case "disconnected":
+	default:
+		return false, nil
+	}
+
+	var event struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return true, err
+	}
+	reason := event.Reason
+	if reason == "" {
+		reason = "unknown"
+	}
+
+	seen, ok := e.reasons[node]
+	if !ok {
+		seen = make(map[string]bool)
+		e.reasons[node] = seen
+	}
+	if !seen[reason] {
+		if len(seen) >= maxDisconnectReasons {
+			reason = "other"
+		}
+		seen[reason] = true
+	}
+
+	e.disconnected.WithLabelValues(node, reason).Inc()
+	if event.Reason != "normal" {
+		e.abnormal.WithLabelValues(node).Inc()
+	}
+	return true, nil
+}
+
+func (e *clientEvents) collectors() []prometheus.Collector {
+	return []prometheus.Collector{e.connected, e.disconnected, e.abnormal}
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// invalidNameChars are the characters of topic levels not allowed in metric names
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	labelNameRE      = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	captureRE        = regexp.MustCompile(`\$(\d+)`)
+)
+
+// DefaultSysMappings convert the documented $SYS topics of EMQ, the stats
+// count/max pairs are named like the polled stats
+var DefaultSysMappings = []config.SysMappingConfig{
+	{Topic: "stats/+/count", Name: "emq_sys_stats_$1", Type: "gauge"},
+	{Topic: "stats/+/max", Name: "emq_sys_stats_$1_max", Type: "gauge"},
+	{Topic: "stats/+/+/count", Name: "emq_sys_stats_$1_$2", Type: "gauge"},
+	{Topic: "stats/+/+/max", Name: "emq_sys_stats_$1_$2_max", Type: "gauge"},
+	{Topic: "stats/#", Name: "emq_sys_stats_$1", Type: "gauge"},
+	{Topic: "metrics/#", Name: "emq_sys_metrics_$1_total", Type: "counter"},
+	{
+		Topic: "uptime",
+		Name:  "emq_sys_uptime_seconds",
+		Help:  "Time since the EMQ broker started, in seconds.",
+		Type:  "gauge",
+		Value: "uptime",
+	},
+	{
+		Topic: "datetime",
+		Name:  "emq_sys_time_seconds",
+		Help:  "Datetime reported by the EMQ broker, in seconds since the epoch.",
+		Type:  "gauge",
+		Value: "datetime",
+	},
+}
+
+// sysMapping is a compiled config.SysMappingConfig
+type sysMapping struct {
+	levels    []string
+	name      string
+	help      string
+	valueType dto.MetricType
+	labels    map[string]string
+	value     string
+}
+
+func compileSysMappings(cfgs []config.SysMappingConfig) ([]*sysMapping, error) {
+	mappings := make([]*sysMapping, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("sys mapping %s: %s", cfg.Topic, err)
+		}
+		for name := range cfg.Labels {
+			if !labelNameRE.MatchString(name) || name == "node" {
+				return nil, fmt.Errorf("sys mapping %s: invalid label name %q", cfg.Topic, name)
+			}
+		}
+
+		valueType, _ := config.ParseValueType(cfg.Type)
+		m := &sysMapping{
+			levels:    strings.Split(cfg.Topic, "/"),
+			name:      cfg.Name,
+			help:      cfg.Help,
+			valueType: familyTypes[valueType],
+			labels:    cfg.Labels,
+			value:     cfg.Value,
+		}
+		if m.help == "" {
+			m.help = "Value of the " + sysTopicPrefix + "<node>/" + cfg.Topic + " topics."
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// familyTypes are the metric family types of the value types
+var familyTypes = map[prometheus.ValueType]dto.MetricType{
+	prometheus.CounterValue: dto.MetricType_COUNTER,
+	prometheus.GaugeValue:   dto.MetricType_GAUGE,
+	prometheus.UntypedValue: dto.MetricType_UNTYPED,
+}
+
+// match returns the levels captured by the wildcards of the mapping if the
+// topic levels match its filter, # matches one or more levels
+func (m *sysMapping) match(levels []string) ([]string, bool) {
+	var captures []string
+	for i, pattern := range m.levels {
+		if pattern == "#" {
+			if i >= len(levels) {
+				return nil, false
+			}
+			return append(captures, strings.Join(levels[i:], "/")), true
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		if pattern == "+" {
+			captures = append(captures, levels[i])
+		} else if pattern != levels[i] {
+			return nil, false
+		}
+	}
+	return captures, len(levels) == len(m.levels)
+}
+
+// parse converts the payload of a matching topic
+func (m *sysMapping) parse(payload string) (float64, error) {
+	switch m.value {
+	case "uptime":
+		uptime, err := parseUptime(payload)
+		return uptime.Seconds(), err
+	case "datetime":
+		t, err := parseBrokerTime(payload)
+		return float64(t.UnixNano()) / 1e9, err
+	default:
+		return strconv.ParseFloat(payload, 64)
+	}
+}
+
+// expandCaptures replaces $1, $2, ... in template by the captured levels
+func expandCaptures(template string, captures []string) string {
+	return captureRE.ReplaceAllStringFunc(template, func(ref string) string {
+		i, _ := strconv.Atoi(ref[1:])
+		if i < 1 || i > len(captures) {
+			return ""
+		}
+		return captures[i-1]
+	})
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// payloadSizeBuckets are the upper bounds of the buckets of the payload
+// sizes, from 16 bytes to 1 MiB
+var payloadSizeBuckets = prometheus.ExponentialBuckets(16, 4, 9)
+
+// payloadSizes observes the payload sizes of the application messages
+// received on the payload filters of the $SYS subscription, so payload
+// bloat, e.g. after a device firmware update, becomes visible
+type payloadSizes struct {
+	filters []*payloadFilter
+	sizes   *prometheus.HistogramVec
+}
+
+// payloadFilter is a topic filter, shared subscriptions are matched by the
+// filter following their group
+type payloadFilter struct {
+	filter string
+	levels []string
+}
+
+func newPayloadSizes(infos *metricInfos, filters []string) *payloadSizes {
+	p := &payloadSizes{
+		sizes: infos.newHistogramVec(prometheus.HistogramOpts{
+			Name:    prometheus.BuildFQName(Namespace, "sys", "message_payload_bytes"),
+			Help:    "Size of the payloads of the messages received on a payload size filter, by filter.",
+			Buckets: payloadSizeBuckets,
+		}, []string{"filter"}),
+	}
+	for _, f := range filters {
+		topic := f
+		if strings.HasPrefix(topic, "$share/") {
+			if parts := strings.SplitN(topic, "/", 3); len(parts) == 3 {
+				topic = parts[2]
+			}
+		} else {
+			topic = strings.TrimPrefix(topic, "$queue/")
+		}
+		p.filters = append(p.filters, &payloadFilter{filter: f, levels: strings.Split(topic, "/")})
+	}
+	return p
+}
+
+// handle observes the payload size if topic matches one of the filters, and
+// reports whether it did
+func (p *payloadSizes) handle(topic string, payload []byte) bool {
+	levels := strings.Split(topic, "/")
+	for _, f := range p.filters {
+		if f.match(levels) {
+			p.sizes.WithLabelValues(f.filter).Observe(float64(len(payload)))
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the topic levels match the filter, # matches the
+// parent level and any number of child levels
+func (f *payloadFilter) match(levels []string) bool {
+	for i, pattern := range f.levels {
+		if pattern == "#" {
+			return true
+		}
+		if i >= len(levels) || pattern != "+" && pattern != levels[i] {
+			return false
+		}
+	}
+	return len(levels) == len(f.levels)
+}
@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// clientTraffic is the value of a client in a top list
+type clientTraffic struct {
+	clientID string
+	value    float64
+}
+
+// topClients keeps the n clients with the highest values, in a min-heap
+// so the client with the lowest value is replaced first
+type topClients struct {
+	n       int
+	clients []clientTraffic
+}
+
+func (t *topClients) Len() int           { return len(t.clients) }
+func (t *topClients) Less(i, j int) bool { return t.clients[i].value < t.clients[j].value }
+func (t *topClients) Swap(i, j int)      { t.clients[i], t.clients[j] = t.clients[j], t.clients[i] }
+func (t *topClients) Push(x interface{}) { t.clients = append(t.clients, x.(clientTraffic)) }
+func (t *topClients) Pop() interface{} {
+	last := t.clients[len(t.clients)-1]
+	t.clients = t.clients[:len(t.clients)-1]
+	return last
+}
+
+// add offers a client to the top list
+func (t *topClients) add(clientID string, value float64) {
+	if len(t.clients) < t.n {
+		heap.Push(t, clientTraffic{clientID: clientID, value: value})
+		return
+	}
+	if t.n > 0 && value > t.clients[0].value {
+		t.clients[0] = clientTraffic{clientID: clientID, value: value}
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted returns the clients of the top list, highest value first
+func (t *topClients) sorted() []clientTraffic {
+	clients := append([]clientTraffic(nil), t.clients...)
+	sort.Slice(clients, func(i, j int) bool { return clients[i].value > clients[j].value })
+	return clients
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// TopicMetricsFetcher is implemented by the fetchers able to register
+// topics for the topic metrics of the broker and to fetch their metrics
+type TopicMetricsFetcher interface {
+	TopicMetrics(ctx context.Context) (emqapi.TopicMetricsResponse, error)
+	RegisterTopicMetrics(ctx context.Context, topic string) (emqapi.CodeResponse, error)
+}
+
+var _ TopicMetricsFetcher = (*emqapi.HTTPClient)(nil)
+
+var (
+	topicMessagesDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "topic", "messages_total"),
+		"Number of messages published to a registered topic of the EMQ broker, by direction, in, out or dropped.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "topic", "direction"}, nil,
+	)
+	topicQoSMessagesDesc = packageInfos.newDesc(
+		prometheus.BuildFQName(Namespace, "topic", "qos_messages_total"),
+		"Number of messages published to a registered topic of the EMQ broker, by QoS level and direction, in or out.",
+		prometheus.CounterValue,
+		[]string{"node", "version", "topic", "qos", "direction"}, nil,
+	)
+)
+
+// parseTopicMetricKey splits a counter key of the topic metrics, e.g.
+// messages.in.count or messages.qos1.out.count, into the QoS level, empty
+// for all levels, and the direction. ok is false for the rates.
+func parseTopicMetricKey(key string) (qos, direction string, ok bool) {
+	parts := strings.Split(key, ".")
+	if len(parts) < 3 || parts[0] != "messages" || parts[len(parts)-1] != "count" {
+		return "", "", false
+	}
+	switch len(parts) {
+	case 3:
+		return "", parts[1], true
+	case 4:
+		if !strings.HasPrefix(parts[1], "qos") {
+			return "", "", false
+		}
+		return strings.TrimPrefix(parts[1], "qos"), parts[2], true
+	}
+	return "", "", false
+}
+
+// collectTopicMetrics registers the configured topics the broker does not
+// count yet, e.g. after a restart, and sends the message counters of the
+// registered ones. Failures are logged without marking the node as down.
+func (c *Collector) collectTopicMetrics(ctx context.Context, logger log.Logger, ch chan<- prometheus.Metric, labels []*dto.LabelPair) {
+	fetcher, ok := c.client.(TopicMetricsFetcher)
+	if !ok {
+		return
+	}
+	if !c.caps.enabled("topic_metrics") {
+		return
+	}
+	topics, err := fetcher.TopicMetrics(ctx)
+	c.caps.record("topic_metrics", err)
+	if err != nil {
+		c.optionalError(logger, err)
+		return
+	}
+	if topics.Code != 0 {
+		c.recordAPIError(logger, "topic_metrics", topics.Code)
+		return
+	}
+	c.markSuccess("topic_metrics")
+
+	registered := make(map[string]bool, len(topics.Result))
+	for _, t := range topics.Result {
+		registered[t.Topic] = true
+	}
+	for _, topic := range c.topicMetrics {
+		if registered[topic] {
+			continue
+		}
+		res, err := fetcher.RegisterTopicMetrics(ctx, topic)
+		if err == nil && res.Code != 0 {
+			err = fmt.Errorf("code %d: %s", res.Code, res.Message)
+		}
+		if err != nil {
+			c.errorLog.Error(logger, fmt.Errorf("failed to register topic %s for topic metrics: %s", topic, err))
+			continue
+		}
+		logger.Infof("Registered topic %s for topic metrics", topic)
+	}
+
+	for _, t := range topics.Result {
+		topicLabels := mergeLabelPairs(labels, newLabelPairs([]string{"topic"}, []string{t.Topic}))
+		for key, value := range t.Metrics {
+			qos, direction, ok := parseTopicMetricKey(key)
+			if !ok {
+				continue
+			}
+			m := &snapshotMetric{
+				desc:      topicMessagesDesc,
+				valueType: prometheus.CounterValue,
+				value:     value,
+				labels:    mergeLabelPairs(topicLabels, newLabelPairs([]string{"direction"}, []string{direction})),
+			}
+			if qos != "" {
+				m.desc = topicQoSMessagesDesc
+				m.labels = mergeLabelPairs(topicLabels, newLabelPairs([]string{"qos", "direction"}, []string{qos, direction}))
+			}
+			ch <- m
+		}
+	}
+}
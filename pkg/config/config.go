@@ -0,0 +1,419 @@
+// Package config loads the exporter configuration file
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/larseen/emq_exporter/pkg/expr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	// captureRE matches the $1, $2, ... captures of the sys mapping names
+	captureRE = regexp.MustCompile(`\$\d+`)
+)
+
+// reservedLabels are added to the metrics of the targets by the exporter
+var reservedLabels = map[string]bool{
+	"target":           true,
+	"exporter_version": true,
+}
+
+// Config is the structure of the exporter configuration file
+type Config struct {
+	Targets         []TargetConfig         `json:"targets"`
+	CustomMetrics   []CustomMetricConfig   `json:"custom_metrics"`
+	CustomEndpoints []CustomEndpointConfig `json:"custom_endpoints"`
+	// DerivedMetrics are computed from the metrics of a node on every scrape
+	DerivedMetrics []DerivedMetricConfig `json:"derived_metrics"`
+	// Timeouts bounds the requests to EMQ API endpoints by endpoint name,
+	// e.g. "stats", or by custom endpoint path, e.g. {"stats": "2s"}
+	Timeouts map[string]string `json:"timeouts"`
+	// Intervals are the minimum intervals between the runs of the optional
+	// collectors by collector name, e.g. {"clients": "5m"}, their last
+	// metrics are exported in between
+	Intervals map[string]string `json:"intervals"`
+	// SysMappings convert the $SYS topics to metrics, they are tried in
+	// order before the default mappings
+	SysMappings []SysMappingConfig `json:"sys_mappings"`
+	// TopicMetrics are registered for the topic metrics of the brokers,
+	// whose message counters are exported by topic
+	TopicMetrics []string `json:"topic_metrics"`
+	// Tenants extracts the tenants of the MQTT clients, whose connections
+	// and subscriptions are exported by tenant, disabled if nil
+	Tenants *TenantConfig `json:"tenants"`
+}
+
+// TenantConfig extracts the tenant of a client with the first capture group
+// of Regex, matched against the client ID or the username as set by Field
+type TenantConfig struct {
+	// Field is "clientid", the default, or "username"
+	Field string `json:"field"`
+	Regex string `json:"regex"`
+}
+
+// TargetConfig describes one EMQ node scraped by the exporter, empty
+// fields are taken from the command line flags
+type TargetConfig struct {
+	Name string `json:"name"`
+	URI  string `json:"uri"`
+	// FallbackURI is requested when URI fails, e.g. the dashboard of
+	// another node of the cluster
+	FallbackURI string    `json:"fallback_uri"`
+	Node        string    `json:"node"`
+	Username    string    `json:"username"`
+	Password    string    `json:"password"`
+	APIKey      string    `json:"api_key"`
+	AuthMode    string    `json:"auth_mode"`
+	TLS         TLSConfig `json:"tls"`
+	// SOCKS5Proxy is the address of a SOCKS5 proxy the node is reached
+	// through, see ParseSOCKS5Proxy
+	SOCKS5Proxy string `json:"socks5_proxy"`
+	// SSH tunnels the requests to the node through an SSH host
+	SSH SSHConfig `json:"ssh"`
+	// Labels are attached to all metrics of the target, e.g. its region or
+	// tenant, labels of the metrics themselves take precedence
+	Labels map[string]string `json:"labels"`
+}
+
+// SSHConfig configures the SSH tunnel to an EMQ node, the port of URI is
+// forwarded through Host, which is host or host:port
+type SSHConfig struct {
+	Host    string `json:"host"`
+	User    string `json:"user"`
+	KeyFile string `json:"key_file"`
+	// KnownHostsFile verifies the host key, ~/.ssh/known_hosts if empty
+	KnownHostsFile string `json:"known_hosts_file"`
+}
+
+// TLSConfig configures the TLS connection to an EMQ node
+type TLSConfig struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// ServerFingerprint pins the SHA256 fingerprint of the server
+	// certificate, e.g. of a self-signed dashboard certificate, in place of
+	// the verification against the CAs
+	ServerFingerprint string `json:"server_fingerprint"`
+}
+
+// CustomMetricConfig describes a metric read from a broker API response
+type CustomMetricConfig struct {
+	Endpoint string `json:"endpoint"`
+	JSONPath string `json:"json_path"`
+	Name     string `json:"name"`
+	Help     string `json:"help"`
+	Type     string `json:"type"`
+}
+
+// CustomEndpointConfig maps the JSON keys of an additional API endpoint to metric names
+type CustomEndpointConfig struct {
+	Path    string            `json:"path"`
+	Type    string            `json:"type"`
+	Metrics map[string]string `json:"metrics"`
+}
+
+// DerivedMetricConfig describes a gauge computed by Expr, an expression over
+// the metrics of a node, see the expr package
+type DerivedMetricConfig struct {
+	Name string `json:"name"`
+	Help string `json:"help"`
+	Expr string `json:"expr"`
+}
+
+// SysMappingConfig maps the $SYS topics matching Topic, a topic filter
+// below $SYS/brokers/<node>/, to a metric. The levels matched by the + and #
+// wildcards are referenced by $1, $2, ... in Name and the Labels values.
+type SysMappingConfig struct {
+	Topic  string            `json:"topic"`
+	Name   string            `json:"name"`
+	Help   string            `json:"help"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+	// Value is how the payload is parsed: number (the default), uptime,
+	// e.g. "1 days, 2 hours", or datetime
+	Value string `json:"value"`
+}
+
+// Load reads and validates the configuration file, an empty filename
+// yields an empty configuration. The custom and derived metrics must not
+// use builtinNames, the names of the metrics served by the exporter itself,
+// whose $1, $2, ... captures match any name part.
+func Load(filename string, builtinNames []string) (*Config, error) {
+	cfg := &Config{}
+	if filename == "" {
+		return cfg, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file %s: %s", filename, err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %s", filename, err)
+	}
+
+	for i, m := range cfg.CustomMetrics {
+		if m.Endpoint == "" || m.JSONPath == "" || m.Name == "" {
+			return nil, fmt.Errorf("custom metric %d: endpoint, json_path and name are required", i)
+		}
+		if _, err := ParseValueType(m.Type); err != nil {
+			return nil, fmt.Errorf("custom metric %s: %s", m.Name, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, t := range cfg.Targets {
+		if t.Name == "" {
+			return nil, fmt.Errorf("target %d: name is required", i)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("target %s: duplicate name", t.Name)
+		}
+		names[t.Name] = true
+		if t.AuthMode != "" && t.AuthMode != emqapi.AuthModeBasic && t.AuthMode != emqapi.AuthModeToken {
+			return nil, fmt.Errorf("target %s: unknown auth mode %q", t.Name, t.AuthMode)
+		}
+		if t.TLS.ServerFingerprint != "" {
+			if _, err := ParseFingerprint(t.TLS.ServerFingerprint); err != nil {
+				return nil, fmt.Errorf("target %s: %s", t.Name, err)
+			}
+		}
+		if t.SOCKS5Proxy != "" {
+			if _, err := ParseSOCKS5Proxy(t.SOCKS5Proxy); err != nil {
+				return nil, fmt.Errorf("target %s: %s", t.Name, err)
+			}
+		}
+		for name := range t.Labels {
+			if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") || reservedLabels[name] {
+				return nil, fmt.Errorf("target %s: invalid label name %q", t.Name, name)
+			}
+		}
+	}
+
+	for i, e := range cfg.CustomEndpoints {
+		if e.Path == "" || len(e.Metrics) == 0 {
+			return nil, fmt.Errorf("custom endpoint %d: path and metrics are required", i)
+		}
+		if _, err := ParseValueType(e.Type); err != nil {
+			return nil, fmt.Errorf("custom endpoint %s: %s", e.Path, err)
+		}
+	}
+
+	for i, m := range cfg.DerivedMetrics {
+		if m.Name == "" || m.Expr == "" {
+			return nil, fmt.Errorf("derived metric %d: name and expr are required", i)
+		}
+		if _, err := expr.Parse(m.Expr); err != nil {
+			return nil, fmt.Errorf("derived metric %s: %s", m.Name, err)
+		}
+	}
+
+	if err := cfg.checkMetricNames(builtinNames); err != nil {
+		return nil, err
+	}
+
+	for i, m := range cfg.SysMappings {
+		if m.Topic == "" || m.Name == "" {
+			return nil, fmt.Errorf("sys mapping %d: topic and name are required", i)
+		}
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("sys mapping %s: %s", m.Topic, err)
+		}
+	}
+
+	for i, topic := range cfg.TopicMetrics {
+		if topic == "" {
+			return nil, fmt.Errorf("topic metric %d: topic is required", i)
+		}
+		if strings.ContainsAny(topic, "+#") {
+			return nil, fmt.Errorf("topic metric %s: wildcards are not supported", topic)
+		}
+	}
+
+	if t := cfg.Tenants; t != nil {
+		if t.Field != "" && t.Field != "clientid" && t.Field != "username" {
+			return nil, fmt.Errorf("tenants: unknown field %q", t.Field)
+		}
+		re, err := regexp.Compile(t.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("tenants: %s", err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("tenants: the regex must have a capture group")
+		}
+	}
+
+	for endpoint, t := range cfg.Timeouts {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, fmt.Errorf("timeout of %s: %s", endpoint, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("timeout of %s: must be positive", endpoint)
+		}
+	}
+
+	for collector, i := range cfg.Intervals {
+		d, err := time.ParseDuration(i)
+		if err != nil {
+			return nil, fmt.Errorf("interval of %s: %s", collector, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("interval of %s: must be positive", collector)
+		}
+	}
+
+	return cfg, nil
+}
+
+// EndpointTimeouts returns the parsed timeouts of the endpoints
+func (cfg *Config) EndpointTimeouts() map[string]time.Duration {
+	timeouts := make(map[string]time.Duration, len(cfg.Timeouts))
+	for endpoint, t := range cfg.Timeouts {
+		timeouts[endpoint], _ = time.ParseDuration(t)
+	}
+	return timeouts
+}
+
+// CollectorIntervals returns the parsed intervals of the collectors
+func (cfg *Config) CollectorIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration, len(cfg.Intervals))
+	for collector, i := range cfg.Intervals {
+		intervals[collector], _ = time.ParseDuration(i)
+	}
+	return intervals
+}
+
+// AllCustomMetrics expands the custom endpoints into custom metric definitions
+func (cfg *Config) AllCustomMetrics() []CustomMetricConfig {
+	metrics := append([]CustomMetricConfig{}, cfg.CustomMetrics...)
+	for _, e := range cfg.CustomEndpoints {
+		keys := make([]string, 0, len(e.Metrics))
+		for key := range e.Metrics {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			metrics = append(metrics, CustomMetricConfig{
+				Endpoint: e.Path,
+				JSONPath: key,
+				Name:     e.Metrics[key],
+				Help:     fmt.Sprintf("Value of %s from %s.", key, e.Path),
+				Type:     e.Type,
+			})
+		}
+	}
+	return metrics
+}
+
+// checkMetricNames checks the names of the custom and derived metrics are
+// valid and not used by any other metric
+func (cfg *Config) checkMetricNames(builtinNames []string) error {
+	used := make(map[string]string)
+	// templates are the names with captures, by what uses them
+	templates := make(map[*regexp.Regexp]string)
+	reserve := func(name, kind string) {
+		if re, ok := nameTemplate(name); ok {
+			templates[re] = kind
+			return
+		}
+		used[name] = kind
+	}
+	for _, name := range builtinNames {
+		reserve(name, "a built-in metric")
+	}
+	for _, m := range cfg.SysMappings {
+		reserve(m.Name, "a sys mapping")
+	}
+	check := func(kind, name string) error {
+		if !metricNameRE.MatchString(name) {
+			return fmt.Errorf("%s %s: invalid metric name", kind, name)
+		}
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("%s %s: the name is already used by %s", kind, name, other)
+		}
+		for re, other := range templates {
+			if re.MatchString(name) {
+				return fmt.Errorf("%s %s: the name is already used by %s", kind, name, other)
+			}
+		}
+		used[name] = "a " + kind
+		return nil
+	}
+
+	for _, m := range cfg.AllCustomMetrics() {
+		if err := check("custom metric", m.Name); err != nil {
+			return err
+		}
+	}
+	for _, m := range cfg.DerivedMetrics {
+		if err := check("derived metric", m.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nameTemplate returns a regex matching the names of a sys mapping name
+// with $1, $2, ... captures, whose invalid characters are replaced by _
+func nameTemplate(name string) (*regexp.Regexp, bool) {
+	if !captureRE.MatchString(name) {
+		return nil, false
+	}
+	parts := captureRE.Split(name, -1)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, "[a-zA-Z0-9_]+") + "$"), true
+}
+
+// Validate checks the topic filter, type and value of the mapping
+func (m SysMappingConfig) Validate() error {
+	levels := strings.Split(m.Topic, "/")
+	for i, level := range levels {
+		if level == "#" && i != len(levels)-1 {
+			return fmt.Errorf("# must be the last level of the topic")
+		}
+		if level != "#" && level != "+" && strings.ContainsAny(level, "#+") {
+			return fmt.Errorf("wildcards must fill a whole level of the topic")
+		}
+	}
+	if _, err := ParseValueType(m.Type); err != nil {
+		return err
+	}
+	switch m.Value {
+	case "", "number", "uptime", "datetime":
+	default:
+		return fmt.Errorf("unknown value %q", m.Value)
+	}
+	return nil
+}
+
+// ParseValueType converts the type of a custom metric, which defaults to gauge
+func ParseValueType(t string) (prometheus.ValueType, error) {
+	switch t {
+	case "", "gauge":
+		return prometheus.GaugeValue, nil
+	case "counter":
+		return prometheus.CounterValue, nil
+	case "untyped":
+		return prometheus.UntypedValue, nil
+	default:
+		return 0, fmt.Errorf("unknown metric type %q", t)
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseSOCKS5Proxy parses the address of a SOCKS5 proxy, either host:port,
+// user:password@host:port or a socks5:// URL
+func ParseSOCKS5Proxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "socks5://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		// the url.Error repeats the input, password included
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("invalid SOCKS5 proxy %s: %s", redactProxy(s), err)
+	}
+	if u.Scheme != "socks5" {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy %s: scheme must be socks5", redactProxy(s))
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy %s: missing port", redactProxy(s))
+	}
+	return u, nil
+}
+
+// redactProxy masks the password of a proxy address for the error messages,
+// it works on the raw input as that may not parse
+func redactProxy(s string) string {
+	start := strings.Index(s, "://") + len("://")
+	end := strings.IndexAny(s[start:], "/?#")
+	if end < 0 {
+		end = len(s)
+	} else {
+		end += start
+	}
+	at := strings.LastIndex(s[start:end], "@")
+	if at < 0 {
+		return s
+	}
+	at += start
+	userinfo := s[start:at]
+	if i := strings.Index(userinfo, ":"); i >= 0 {
+		userinfo = userinfo[:i] + ":xxxxx"
+	}
+	return s[:start] + userinfo + s[at:]
+}
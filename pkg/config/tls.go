@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// NewTLSConfig builds the TLS configuration of the connection to an EMQ node
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		b, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %s", cfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.ServerFingerprint != "" {
+		pin, err := ParseFingerprint(cfg.ServerFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// the pinned certificate replaces the verification against the CAs
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no server certificate")
+			}
+			if sum := sha256.Sum256(rawCerts[0]); !bytes.Equal(sum[:], pin) {
+				return fmt.Errorf("server certificate fingerprint %x does not match the pinned one", sum)
+			}
+			return nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// ParseFingerprint parses a SHA256 certificate fingerprint in hex, with or
+// without colons between the bytes
+func ParseFingerprint(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.Replace(s, ":", "", -1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server fingerprint %s: %s", s, err)
+	}
+	if len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid server fingerprint %s: must be a SHA256 hash", s)
+	}
+	return b, nil
+}
@@ -0,0 +1,234 @@
+package emqapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/tracing"
+)
+
+// APIVersion describes the endpoint layout of one version of the EMQ HTTP API
+type APIVersion struct {
+	name           string
+	nodesPath      string
+	metricsPath    string
+	statsPath      string
+	managementPath string
+	listenersPath  string
+	// clientsPath is empty for versions whose client listing is not supported
+	clientsPath string
+	// licensePath is empty for versions without the license endpoint of
+	// the enterprise brokers
+	licensePath string
+	// exhooksPath and exhookHooksPath are empty for versions without the
+	// endpoints of the exhook extension, {name} is the name of the server
+	exhooksPath     string
+	exhookHooksPath string
+	// gatewaysPath is empty for versions without the multi-protocol gateways
+	gatewaysPath string
+	// slowSubscriptionsPath and alarmsPath are empty for versions without
+	// the slow subscriptions statistics and the activated alarms
+	slowSubscriptionsPath string
+	alarmsPath            string
+	// topicMetricsPath is empty for versions without topic metrics
+	topicMetricsPath string
+	// brokersPath is a small endpoint used to check the node is reachable
+	brokersPath string
+	// resultKey is the name of the envelope field holding the payload
+	resultKey string
+	// dottedKeys is set for versions separating the parts of metric and
+	// stats keys with dots instead of slashes, e.g. "connections.count"
+	dottedKeys bool
+}
+
+var apiVersions = []*APIVersion{
+	{
+		name:                  "v4",
+		nodesPath:             "/api/v4/nodes/{node}",
+		metricsPath:           "/api/v4/nodes/{node}/metrics",
+		statsPath:             "/api/v4/nodes/{node}/stats",
+		managementPath:        "/api/v4/nodes",
+		listenersPath:         "/api/v4/nodes/{node}/listeners",
+		clientsPath:           "/api/v4/nodes/{node}/clients",
+		brokersPath:           "/api/v4/brokers/{node}",
+		licensePath:           "/api/v4/license",
+		exhooksPath:           "/api/v4/exhooks",
+		exhookHooksPath:       "/api/v4/exhooks/{name}/hooks",
+		gatewaysPath:          "/api/v4/gateways",
+		slowSubscriptionsPath: "/api/v4/slow_subscriptions",
+		alarmsPath:            "/api/v4/alarms/activated",
+		topicMetricsPath:      "/api/v4/topic-metrics",
+		resultKey:             "data",
+		dottedKeys:            true,
+	},
+	{
+		name:           "v3",
+		nodesPath:      "/api/v3/nodes/{node}",
+		metricsPath:    "/api/v3/nodes/{node}/metrics/",
+		statsPath:      "/api/v3/nodes/{node}/stats/",
+		managementPath: "/api/v3/nodes",
+		listenersPath:  "/api/v3/nodes/{node}/listeners",
+		clientsPath:    "/api/v3/nodes/{node}/clients",
+		brokersPath:    "/api/v3/brokers/{node}",
+		resultKey:      "data",
+	},
+	{
+		name:           "v2",
+		nodesPath:      "/api/v2/monitoring/nodes/{node}",
+		metricsPath:    "/api/v2/monitoring/metrics/{node}",
+		statsPath:      "/api/v2/monitoring/stats/{node}",
+		managementPath: "/api/v2/management/nodes",
+		listenersPath:  "/api/v2/monitoring/listeners/{node}",
+		brokersPath:    "/api/v2/management/nodes/{node}",
+		resultKey:      "result",
+	},
+}
+
+// FindAPIVersion returns the API version with the given name, e.g. "v4"
+func FindAPIVersion(name string) (*APIVersion, error) {
+	for _, v := range apiVersions {
+		if v.name == name {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported EMQ API version %q", name)
+}
+
+// Name returns the name of the API version, e.g. "v4"
+func (a *APIVersion) Name() string {
+	return a.name
+}
+
+// path returns the escaped path of an endpoint of node
+func (a *APIVersion) path(path, node string) string {
+	return nodePath(path, node)
+}
+
+// nodePath replaces {node} in path with the escaped node name, which may
+// contain characters like / or non-ASCII letters
+func nodePath(path, node string) string {
+	return strings.Replace(path, "{node}", url.PathEscape(node), -1)
+}
+
+// decode unmarshals an API response into v, normalizing the payload
+// envelope so that every version can be decoded into the same structs
+func (a *APIVersion) decode(r io.Reader, v interface{}) error {
+	if a.resultKey == "result" {
+		return json.NewDecoder(r).Decode(v)
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&envelope); err != nil {
+		return err
+	}
+	if data, ok := envelope[a.resultKey]; ok {
+		if a.dottedKeys {
+			var err error
+			if data, err = slashKeys(data); err != nil {
+				return err
+			}
+		}
+		envelope["result"] = data
+		delete(envelope, a.resultKey)
+	}
+
+	b, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// slashKeys replaces the dots in the keys of a payload object, or of the
+// objects of a payload list, with slashes
+func slashKeys(data json.RawMessage) (json.RawMessage, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var payload interface{}
+	if err := d.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	rename := func(v interface{}) interface{} {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		renamed := make(map[string]interface{}, len(obj))
+		for k, v := range obj {
+			renamed[strings.Replace(k, ".", "/", -1)] = v
+		}
+		return renamed
+	}
+	if list, ok := payload.([]interface{}); ok {
+		for i, v := range list {
+			list[i] = rename(v)
+		}
+	} else {
+		payload = rename(payload)
+	}
+	return json.Marshal(payload)
+}
+
+// detectAPIVersion probes the management endpoint of every known API
+// version, newest first, and returns the first one answered by the broker
+func (c *HTTPClient) detectAPIVersion(ctx context.Context) (*APIVersion, error) {
+	for _, v := range apiVersions {
+		res, u, err := c.get(ctx, v.managementPath)
+		if err != nil {
+			return nil, &RequestError{Op: "detect API version from", URL: displayURL(u), Err: err}
+		}
+		res.Body.Close()
+
+		if res.StatusCode == http.StatusOK {
+			return v, nil
+		}
+		if isAuthFailure(res.StatusCode) {
+			return nil, statusError(u, res.StatusCode)
+		}
+	}
+	base, _ := c.baseURL()
+	return nil, fmt.Errorf("failed to detect API version from %s: no known API answered", displayURL(base))
+}
+
+// APIVersion returns the API version of the node, detecting it on first use
+func (c *HTTPClient) APIVersion(ctx context.Context) (*APIVersion, error) {
+	c.apiMtx.Lock()
+	defer c.apiMtx.Unlock()
+
+	if c.apiVersion != nil {
+		return c.apiVersion, nil
+	}
+
+	start := time.Now()
+	v, err := c.detectAPIVersion(ctx)
+	c.observe("api_version", time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	tracing.Logger(ctx).Infof("Detected EMQ API version %s", v.name)
+	c.apiVersion = v
+	return v, nil
+}
+
+// InheritAPIVersion takes over the API version prev detected, e.g. the client
+// of the same node built from the previous configuration, unless c already
+// knows the version of the node
+func (c *HTTPClient) InheritAPIVersion(prev *HTTPClient) {
+	prev.apiMtx.Lock()
+	api := prev.apiVersion
+	prev.apiMtx.Unlock()
+
+	c.apiMtx.Lock()
+	defer c.apiMtx.Unlock()
+	if c.apiVersion == nil {
+		c.apiVersion = api
+	}
+}
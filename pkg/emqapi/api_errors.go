@@ -0,0 +1,28 @@
+package emqapi
+
+// apiErrorCodes are the meanings of the non-zero codes returned by the EMQ API
+var apiErrorCodes = map[int]string{
+	101: "RPC error",
+	102: "unknown error",
+	103: "username or password error",
+	104: "empty username or password",
+	105: "user does not exist",
+	106: "admin can not be deleted",
+	107: "missing request parameter",
+	108: "request parameter type error",
+	109: "request parameter is not a JSON",
+	110: "plugin has been loaded",
+	111: "plugin has been unloaded",
+	112: "client not online",
+	113: "user already exists",
+	114: "old password error",
+	115: "bad topic",
+}
+
+// ErrorMeaning describes a non-zero result code returned by the EMQ API
+func ErrorMeaning(code int) string {
+	if meaning, ok := apiErrorCodes[code]; ok {
+		return meaning
+	}
+	return "unknown error code"
+}
@@ -0,0 +1,68 @@
+package emqapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNodePath(t *testing.T) {
+	tests := []struct {
+		node string
+		// escaped is the node name as it appears in the request path
+		escaped string
+	}{
+		{"emq@127.0.0.1", "emq@127.0.0.1"},
+		{"emqx@host.example.com", "emqx@host.example.com"},
+		{"emqx@pod/0", "emqx@pod%2F0"},
+		{"emqx@100%", "emqx@100%25"},
+		{"emqx@10.0.0.1%eth0", "emqx@10.0.0.1%25eth0"},
+		{"emq node@host", "emq%20node@host"},
+		{"emqx@hôte", "emqx@h%C3%B4te"},
+		{"брокер@узел", "%D0%B1%D1%80%D0%BE%D0%BA%D0%B5%D1%80@%D1%83%D0%B7%D0%B5%D0%BB"},
+		{"emqx@a?b#c", "emqx@a%3Fb%23c"},
+	}
+	// the stats paths of the API versions, with {node} in place of the node
+	statsPaths := map[string]string{
+		"v4": "/api/v4/nodes/{node}/stats",
+		"v3": "/api/v3/nodes/{node}/stats/",
+		"v2": "/api/v2/monitoring/stats/{node}",
+	}
+
+	for _, version := range []string{"v4", "v3", "v2"} {
+		for _, basePath := range []string{"", "/emqx/"} {
+			for _, test := range tests {
+				t.Run(fmt.Sprintf("%s%s/%s", version, basePath, test.node), func(t *testing.T) {
+					var requestURI string
+					srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						requestURI = r.RequestURI
+						fmt.Fprint(w, `{"code":0,"data":{},"result":{}}`)
+					}))
+					defer srv.Close()
+
+					u, _ := url.Parse(srv.URL)
+					api, err := FindAPIVersion(version)
+					if err != nil {
+						t.Fatal(err)
+					}
+					c := New(http.DefaultClient, u, test.node, "admin", "public", api, Options{APIBasePath: basePath})
+					if _, err := c.Stats(context.Background()); err != nil {
+						t.Fatal(err)
+					}
+
+					want := strings.Replace(statsPaths[version], "{node}", test.escaped, 1)
+					if basePath != "" {
+						want = "/emqx" + want
+					}
+					if requestURI != want {
+						t.Errorf("requested %s, want %s", requestURI, want)
+					}
+				})
+			}
+		}
+	}
+}
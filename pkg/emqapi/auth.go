@@ -0,0 +1,162 @@
+package emqapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/tracing"
+)
+
+// Authentication modes of the client
+const (
+	AuthModeBasic = "basic"
+	AuthModeToken = "token"
+
+	// tokenLoginPath is the EMQX 4 dashboard login endpoint
+	tokenLoginPath = "/api/v4/auth"
+	// loginEndpoint is the endpoint name of the login, for timeouts and
+	// the observer
+	loginEndpoint = "login"
+)
+
+type tokenLoginResponse struct {
+	Code  int    `json:"code"`
+	Token string `json:"token"`
+	Data  struct {
+		Token string `json:"token"`
+	} `json:"data"`
+}
+
+// authenticate adds the credentials of the target to an API request, a
+// login needed for the session token is bound to ctx
+func (c *HTTPClient) authenticate(ctx context.Context, req *http.Request) error {
+	if c.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.APIKey)
+		return nil
+	}
+	if c.opts.AuthMode == AuthModeToken {
+		token, err := c.token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	req.SetBasicAuth(c.username, c.password)
+	return nil
+}
+
+// token returns the cached dashboard session token, logging in if there is none
+func (c *HTTPClient) token(ctx context.Context) (string, error) {
+	c.tokenMtx.Lock()
+	defer c.tokenMtx.Unlock()
+
+	if c.sessionToken != "" {
+		return c.sessionToken, nil
+	}
+	token, err := c.login(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.sessionToken = token
+	return token, nil
+}
+
+// login logs in to the dashboard and returns the session token. Like the
+// other requests it is bound to ctx and the timeout of its endpoint, login,
+// traced and reported to the observer, so a hanging login cannot hold up
+// the requests waiting for the token beyond the scrape.
+func (c *HTTPClient) login(ctx context.Context) (token string, err error) {
+	start := time.Now()
+	defer func() { c.observe(loginEndpoint, time.Since(start), err) }()
+
+	if timeout, ok := c.opts.Timeouts[loginEndpoint]; ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	u := c.endpointURL(tokenLoginPath)
+	ctx, span := tracing.StartSpan(ctx, "fetch "+loginEndpoint, tracing.SpanKindClient)
+	span.SetAttribute("http.url", u.String())
+	defer func() { span.Finish(err) }()
+
+	body, err := json.Marshal(map[string]string{
+		"username": c.username,
+		"password": c.password,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.client.Do(prepareRequest(ctx, req))
+	if err != nil {
+		return "", &RequestError{Op: "log in to", URL: displayURL(u), Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", statusError(u, res.StatusCode)
+	}
+
+	var login tokenLoginResponse
+	if err := json.NewDecoder(res.Body).Decode(&login); err != nil {
+		return "", &DecodeError{URL: displayURL(u), Err: err}
+	}
+
+	token = login.Token
+	if token == "" {
+		token = login.Data.Token
+	}
+	if login.Code != 0 || token == "" {
+		return "", fmt.Errorf("failed to log in to %s: no token returned (code %d)", displayURL(u), login.Code)
+	}
+	return token, nil
+}
+
+// invalidateToken drops the cached session token so the next request logs in again
+func (c *HTTPClient) invalidateToken() {
+	c.tokenMtx.Lock()
+	defer c.tokenMtx.Unlock()
+	c.sessionToken = ""
+}
+
+// do authenticates and sends an API request. In token mode an expired
+// session is refreshed and the request retried once.
+func (c *HTTPClient) do(req *http.Request) (*http.Response, error) {
+	if err := c.authenticate(req.Context(), req); err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil || !isAuthFailure(res.StatusCode) {
+		return res, err
+	}
+
+	if c.opts.AuthMode == AuthModeToken && c.opts.APIKey == "" {
+		res.Body.Close()
+		c.invalidateToken()
+		if err := c.authenticate(req.Context(), req); err != nil {
+			return nil, err
+		}
+		// the body of the first attempt was consumed
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		return c.client.Do(req)
+	}
+	return res, nil
+}
+
+func isAuthFailure(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
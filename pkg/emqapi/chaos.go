@@ -0,0 +1,27 @@
+package emqapi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// inject delays the request to endpoint by the configured latency and fails
+// it if the endpoint is one of the configured failing endpoints, to test
+// alerting on unhealthy brokers
+func (c *HTTPClient) inject(ctx context.Context, endpoint string, u *url.URL) error {
+	if c.opts.Latency > 0 {
+		select {
+		case <-time.After(c.opts.Latency):
+		case <-ctx.Done():
+			return &RequestError{Op: "get " + endpoint + " from", URL: displayURL(u), Err: ctx.Err()}
+		}
+	}
+	for _, e := range c.opts.FailEndpoints {
+		if e == endpoint {
+			return fmt.Errorf("failed to get %s from %s: injected failure", endpoint, displayURL(u))
+		}
+	}
+	return nil
+}
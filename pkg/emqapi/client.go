@@ -0,0 +1,507 @@
+// Package emqapi is a client for the management HTTP API of EMQ brokers
+package emqapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/tracing"
+)
+
+// traceIDHeader is the header carrying the scrape trace ID on every API request
+const traceIDHeader = "X-Request-Id"
+
+// maxSlowSubscriptions is the largest number of slow subscriptions the
+// brokers keep, which are fetched in one page
+const maxSlowSubscriptions = 1000
+
+// Observer is notified of the duration and outcome of every API request
+type Observer interface {
+	ObserveRequest(endpoint string, duration time.Duration, err error)
+}
+
+// SizeObserver is notified of the size of every API response body, the
+// observer of the client is also used as SizeObserver if it implements it
+type SizeObserver interface {
+	ObserveResponseSize(endpoint string, bytes int64)
+}
+
+// Options holds the optional settings of the client
+type Options struct {
+	// APIBasePath is prepended to every API path, for APIs served behind a reverse proxy
+	APIBasePath string
+	// APIKey is sent as bearer token instead of the username and password when set
+	APIKey string
+	// AuthMode is either AuthModeBasic or AuthModeToken, which logs in to
+	// the dashboard and authenticates with the session token
+	AuthMode string
+	// FallbackURL is requested when the broker URL fails, e.g. the
+	// dashboard of another node of the cluster
+	FallbackURL *url.URL
+	// Timeouts bounds the requests to the endpoints, by endpoint name
+	Timeouts map[string]time.Duration
+	// FailEndpoints are failed without being requested and every request
+	// is delayed by Latency, to simulate an unhealthy broker
+	FailEndpoints []string
+	Latency       time.Duration
+	// DNSCacheTTL is how long the addresses of the broker hostname are
+	// cached by the Resolver of the transport, 0 disables caching
+	DNSCacheTTL time.Duration
+	// Resolver is the resolver dialing the broker, the failed lookups it
+	// reports are passed on to the observer of the client
+	Resolver *Resolver
+	// DumpResponse is called with the raw body of every API response
+	// decoded by the client if set, to collect the payloads of a broker
+	DumpResponse func(node, endpoint string, body []byte)
+	// StrictDecode fails the decoding of responses whose result, or the
+	// structs nested in it, holds keys the response structs do not map, to
+	// surface changes of the API, see APIVersion.unknownFields
+	StrictDecode bool
+}
+
+// HTTPClient talks to the HTTP API of an EMQ node
+type HTTPClient struct {
+	client *http.Client
+	// url is the broker URL, it is never modified so the endpoint URLs of
+	// concurrent requests are built from it without locking
+	url      url.URL
+	node     string
+	password string
+	username string
+	opts     Options
+	observer Observer
+
+	urlMtx      sync.Mutex
+	useFallback bool
+
+	apiMtx     sync.Mutex
+	apiVersion *APIVersion
+
+	tokenMtx     sync.Mutex
+	sessionToken string
+
+	throttleMtx     sync.Mutex
+	throttledUntil  time.Time
+	throttleBackoff time.Duration
+}
+
+// New returns a client for the given node, the API version is detected on
+// first use if api is nil. The client keeps copies of u and the fallback URL.
+func New(client *http.Client, u *url.URL, node string, username string, password string, api *APIVersion, opts Options) *HTTPClient {
+	if opts.FallbackURL != nil {
+		fallback := *opts.FallbackURL
+		opts.FallbackURL = &fallback
+	}
+	return &HTTPClient{
+		client:     client,
+		url:        *u,
+		node:       node,
+		username:   username,
+		password:   password,
+		apiVersion: api,
+		opts:       opts,
+	}
+}
+
+// Node returns the name of the node
+func (c *HTTPClient) Node() string {
+	return c.node
+}
+
+// ForNode returns a client for another node of the same cluster, which
+// shares the HTTP client, credentials, options and detected API version of
+// c. DNS lookup failures stay reported to the observer of c.
+func (c *HTTPClient) ForNode(node string) *HTTPClient {
+	c.apiMtx.Lock()
+	api := c.apiVersion
+	c.apiMtx.Unlock()
+
+	opts := c.opts
+	opts.Resolver = nil
+	return New(c.client, &c.url, node, c.username, c.password, api, opts)
+}
+
+// SetObserver reports the API requests of the client to o, it must be
+// called before the client is used
+func (c *HTTPClient) SetObserver(o Observer) {
+	c.observer = o
+	if d, ok := o.(DNSObserver); ok && c.opts.Resolver != nil {
+		c.opts.Resolver.setObserver(d)
+	}
+}
+
+// prepareRequest binds an outgoing API request to ctx and adds the scrape trace ID
+func prepareRequest(ctx context.Context, req *http.Request) *http.Request {
+	req = req.WithContext(ctx)
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		req.Header.Set(traceIDHeader, traceID)
+	}
+	return req
+}
+
+// fetchJSON requests an API path, which may carry a query string, and
+// decodes the JSON response into out. The request is traced and reported
+// to the observer under the given endpoint name.
+func (c *HTTPClient) fetchJSON(ctx context.Context, endpoint, path string, out interface{}) (err error) {
+	start := time.Now()
+	defer func() { c.observe(endpoint, time.Since(start), err) }()
+
+	if timeout, ok := c.opts.Timeouts[endpoint]; ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	u := c.endpointURL(path)
+	ctx, span := tracing.StartSpan(ctx, "fetch "+endpoint, tracing.SpanKindClient)
+	span.SetAttribute("http.url", u.String())
+	defer func() { span.Finish(err) }()
+
+	if err := c.inject(ctx, endpoint, u); err != nil {
+		return err
+	}
+	if err := c.checkThrottle(u); err != nil {
+		return err
+	}
+	res, u, err := c.get(ctx, path)
+	if err != nil {
+		return &RequestError{Op: "get " + endpoint + " from", URL: displayURL(u), Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return c.throttle(u, res.Header)
+	}
+	c.resetThrottle()
+	if res.StatusCode != http.StatusOK {
+		return statusError(u, res.StatusCode)
+	}
+
+	body := &countingReader{r: res.Body}
+	var r io.Reader = body
+	var raw []byte
+	if c.opts.DumpResponse != nil || c.opts.StrictDecode {
+		if raw, err = ioutil.ReadAll(body); err != nil {
+			return &RequestError{Op: "read " + endpoint + " from", URL: displayURL(u), Err: err}
+		}
+		if c.opts.DumpResponse != nil {
+			c.opts.DumpResponse(c.node, endpoint, raw)
+		}
+		r = bytes.NewReader(raw)
+	}
+	_, decodeSpan := tracing.StartSpan(ctx, "decode", tracing.SpanKindInternal)
+	err = json.NewDecoder(r).Decode(out)
+	decodeSpan.Finish(err)
+	if o, ok := c.observer.(SizeObserver); ok {
+		o.ObserveResponseSize(endpoint, body.n)
+	}
+	if err != nil {
+		return &DecodeError{URL: displayURL(u), Err: err}
+	}
+
+	if e, ok := out.(*envelope); ok && c.opts.StrictDecode {
+		unknown, err := e.api.unknownFields(raw, e.v)
+		if err != nil {
+			return &DecodeError{URL: displayURL(u), Err: err}
+		}
+		if len(unknown) > 0 {
+			if o, ok := c.observer.(UnknownFieldsObserver); ok {
+				o.ObserveUnknownFields(endpoint, unknown)
+			}
+			return &DecodeError{URL: displayURL(u), Err: fmt.Errorf("unknown fields %s", strings.Join(unknown, ", "))}
+		}
+	}
+	return nil
+}
+
+// postJSON sends in as JSON body to an API path and decodes the JSON
+// response into out. The request is reported to the observer under the
+// given endpoint name, and neither retried nor failed over as it changes
+// the state of the broker.
+func (c *HTTPClient) postJSON(ctx context.Context, endpoint, path string, in, out interface{}) (err error) {
+	start := time.Now()
+	defer func() { c.observe(endpoint, time.Since(start), err) }()
+
+	u := c.endpointURL(path)
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.do(prepareRequest(ctx, req))
+	if err != nil {
+		return &RequestError{Op: "post " + endpoint + " to", URL: displayURL(u), Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(u, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return &DecodeError{URL: displayURL(u), Err: err}
+	}
+	return nil
+}
+
+func (c *HTTPClient) observe(endpoint string, duration time.Duration, err error) {
+	if c.observer != nil {
+		c.observer.ObserveRequest(endpoint, duration, err)
+	}
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// envelope decodes a response of the given API version into v
+type envelope struct {
+	api *APIVersion
+	v   interface{}
+}
+
+func (e *envelope) UnmarshalJSON(b []byte) error {
+	return e.api.decode(bytes.NewReader(b), e.v)
+}
+
+// Nodes fetches the nodes endpoint of the node
+func (c *HTTPClient) Nodes(ctx context.Context) (chr NodesResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	err = c.fetchJSON(ctx, "nodes", api.path(api.nodesPath, c.node), &envelope{api, &chr})
+	return chr, err
+}
+
+// Metrics fetches the metrics endpoint of the node
+func (c *HTTPClient) Metrics(ctx context.Context) (chr MetricsResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	err = c.fetchJSON(ctx, "metrics", api.path(api.metricsPath, c.node), &envelope{api, &chr})
+	return chr, err
+}
+
+// Stats fetches the stats endpoint of the node
+func (c *HTTPClient) Stats(ctx context.Context) (chr StatsResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	err = c.fetchJSON(ctx, "stats", api.path(api.statsPath, c.node), &envelope{api, &chr})
+	return chr, err
+}
+
+// Management fetches the management endpoint listing every node of the cluster
+func (c *HTTPClient) Management(ctx context.Context) (chr ManagementResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	err = c.fetchJSON(ctx, "management", api.managementPath, &envelope{api, &chr})
+	return chr, err
+}
+
+// Listeners fetches the protocol listeners of the node
+func (c *HTTPClient) Listeners(ctx context.Context) (chr ListenersResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	err = c.fetchJSON(ctx, "listeners", api.path(api.listenersPath, c.node), &envelope{api, &chr})
+	return chr, err
+}
+
+// Clients fetches one page of the MQTT clients connected to the node,
+// pages are numbered from 1
+func (c *HTTPClient) Clients(ctx context.Context, page, limit int) (chr ClientsResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.clientsPath == "" {
+		return chr, &NotFoundError{URL: "clients endpoint of API version " + api.name}
+	}
+
+	q := url.Values{}
+	q.Set("_page", strconv.Itoa(page))
+	q.Set("_limit", strconv.Itoa(limit))
+	path := api.path(api.clientsPath, c.node) + "?" + q.Encode()
+	err = c.fetchJSON(ctx, "clients", path, &envelope{api, &chr})
+	return chr, err
+}
+
+// Brokers fetches the description of the broker running on the node
+func (c *HTTPClient) Brokers(ctx context.Context) (chr BrokersResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	err = c.fetchJSON(ctx, "brokers", api.path(api.brokersPath, c.node), &envelope{api, &chr})
+	return chr, err
+}
+
+// License fetches the license of an enterprise broker
+func (c *HTTPClient) License(ctx context.Context) (chr LicenseResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.licensePath == "" {
+		return chr, &NotFoundError{URL: "license endpoint of API version " + api.name}
+	}
+	err = c.fetchJSON(ctx, "license", api.licensePath, &envelope{api, &chr})
+	return chr, err
+}
+
+// Exhooks fetches the gRPC servers of the exhook extension
+func (c *HTTPClient) Exhooks(ctx context.Context) (chr ExhooksResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.exhooksPath == "" {
+		return chr, &NotFoundError{URL: "exhooks endpoint of API version " + api.name}
+	}
+	err = c.fetchJSON(ctx, "exhooks", api.exhooksPath, &envelope{api, &chr})
+	return chr, err
+}
+
+// ExhookHooks fetches the hooks registered by an exhook server, with their
+// invocation counters
+func (c *HTTPClient) ExhookHooks(ctx context.Context, server string) (chr ExhookHooksResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.exhookHooksPath == "" {
+		return chr, &NotFoundError{URL: "exhook hooks endpoint of API version " + api.name}
+	}
+	path := strings.Replace(api.exhookHooksPath, "{name}", url.PathEscape(server), -1)
+	err = c.fetchJSON(ctx, "exhook_hooks", path, &envelope{api, &chr})
+	return chr, err
+}
+
+// Gateways fetches the multi-protocol gateways, e.g. CoAP or LwM2M
+func (c *HTTPClient) Gateways(ctx context.Context) (chr GatewaysResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.gatewaysPath == "" {
+		return chr, &NotFoundError{URL: "gateways endpoint of API version " + api.name}
+	}
+	err = c.fetchJSON(ctx, "gateways", api.gatewaysPath, &envelope{api, &chr})
+	return chr, err
+}
+
+// SlowSubscriptions fetches the slowest subscriptions of the cluster, the
+// broker keeps the top subscriptions by delivery latency
+func (c *HTTPClient) SlowSubscriptions(ctx context.Context) (chr SlowSubscriptionsResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.slowSubscriptionsPath == "" {
+		return chr, &NotFoundError{URL: "slow subscriptions endpoint of API version " + api.name}
+	}
+	q := url.Values{}
+	q.Set("_page", "1")
+	q.Set("_limit", strconv.Itoa(maxSlowSubscriptions))
+	err = c.fetchJSON(ctx, "slow_subscriptions", api.slowSubscriptionsPath+"?"+q.Encode(), &envelope{api, &chr})
+	return chr, err
+}
+
+// Alarms fetches the activated alarms of every node of the cluster
+func (c *HTTPClient) Alarms(ctx context.Context) (chr AlarmsResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.alarmsPath == "" {
+		return chr, &NotFoundError{URL: "alarms endpoint of API version " + api.name}
+	}
+	err = c.fetchJSON(ctx, "alarms", api.alarmsPath, &envelope{api, &chr})
+	return chr, err
+}
+
+// TopicMetrics fetches the metrics of the topics registered for topic metrics
+func (c *HTTPClient) TopicMetrics(ctx context.Context) (chr TopicMetricsResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.topicMetricsPath == "" {
+		return chr, &NotFoundError{URL: "topic metrics endpoint of API version " + api.name}
+	}
+	err = c.fetchJSON(ctx, "topic_metrics", api.topicMetricsPath, &envelope{api, &chr})
+	return chr, err
+}
+
+// RegisterTopicMetrics registers a topic for topic metrics, the broker then
+// counts the messages published to it
+func (c *HTTPClient) RegisterTopicMetrics(ctx context.Context, topic string) (chr CodeResponse, err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return chr, err
+	}
+	if api.topicMetricsPath == "" {
+		return chr, &NotFoundError{URL: "topic metrics endpoint of API version " + api.name}
+	}
+	err = c.postJSON(ctx, "register_topic_metrics", api.topicMetricsPath, map[string]string{"topic": topic}, &chr)
+	return chr, err
+}
+
+// Ping requests the brokers endpoint of the node, which is far cheaper for
+// the broker than the metric endpoints, and only checks the response status
+func (c *HTTPClient) Ping(ctx context.Context) (err error) {
+	api, err := c.APIVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	defer func() { c.observe("ping", time.Since(start), err) }()
+
+	res, u, err := c.get(ctx, api.path(api.brokersPath, c.node))
+	if err != nil {
+		return &RequestError{Op: "ping", URL: displayURL(u), Err: err}
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(u, res.StatusCode)
+	}
+	return nil
+}
+
+// Custom fetches an arbitrary endpoint, replacing {node} in path with the node name
+func (c *HTTPClient) Custom(ctx context.Context, path string) (interface{}, error) {
+	var chr interface{}
+	err := c.fetchJSON(ctx, path, nodePath(path, c.node), &chr)
+	return chr, err
+}
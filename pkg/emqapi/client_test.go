@@ -0,0 +1,136 @@
+package emqapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestConcurrentRequests requests a broker URL with a path from many
+// goroutines, through the client and clients of other nodes, while the
+// failing servers make the requests fail over back and forth. Run with
+// -race, the broker URL must be read without a data race.
+func TestConcurrentRequests(t *testing.T) {
+	var requests int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// every third request fails, which switches to the other URL
+		if atomic.AddInt64(&requests, 1)%3 == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/emq/api/v4/nodes/") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"code":0,"data":{"connections.count":1}}`)
+	}
+	primary := httptest.NewServer(http.HandlerFunc(handler))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(handler))
+	defer fallback.Close()
+
+	u, _ := url.Parse(primary.URL + "/emq")
+	fallbackURL, _ := url.Parse(fallback.URL + "/emq")
+	api, _ := FindAPIVersion("v4")
+	c := New(http.DefaultClient, u, "emq@127.0.0.1", "admin", "public", api, Options{FallbackURL: fallbackURL})
+	// changing the URL passed to New must not affect the client
+	u.Path = "/changed"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := c
+			if i%2 == 1 {
+				client = c.ForNode(fmt.Sprintf("emq@10.0.0.%d", i))
+			}
+			for j := 0; j < 20; j++ {
+				stats, err := client.Stats(context.Background())
+				if err != nil {
+					// both URLs failed
+					continue
+				}
+				if stats.Result.ConnectionsCount == nil || *stats.Result.ConnectionsCount != 1 {
+					t.Errorf("unexpected stats %+v", stats.Result)
+				}
+				client.Serving()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := c.endpointURL("/api/v4/nodes").Path; got != "/emq/api/v4/nodes" {
+		t.Errorf("endpoint URL path is %s after the requests, want /emq/api/v4/nodes", got)
+	}
+}
+
+type recordingObserver struct {
+	mtx       sync.Mutex
+	endpoints []string
+}
+
+func (o *recordingObserver) ObserveRequest(endpoint string, duration time.Duration, err error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.endpoints = append(o.endpoints, endpoint)
+}
+
+// TestHangingLogin checks that a dashboard login which never answers is
+// bound to the scrape context and observed, and does not block the next
+// requests waiting for the session token.
+func TestHangingLogin(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == tokenLoginPath {
+			// the server notices the client going away once the body is read
+			ioutil.ReadAll(r.Body)
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		fmt.Fprint(w, `{"code":0,"data":{}}`)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	api, _ := FindAPIVersion("v4")
+	c := New(http.DefaultClient, u, "emq@127.0.0.1", "admin", "public", api, Options{AuthMode: AuthModeToken})
+	o := &recordingObserver{}
+	c.SetObserver(o)
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		_, err := c.Stats(ctx)
+		cancel()
+		if err == nil {
+			t.Fatal("expected the stats request to fail while the login hangs")
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Fatalf("request %d took %s, the login is not bound to the context", i, d)
+		}
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	logins := 0
+	for _, endpoint := range o.endpoints {
+		if endpoint == loginEndpoint {
+			logins++
+		}
+	}
+	if logins != 2 {
+		t.Errorf("observed %d logins, want 2: %v", logins, o.endpoints)
+	}
+}
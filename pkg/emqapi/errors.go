@@ -0,0 +1,72 @@
+package emqapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AuthError is returned when the EMQ node rejects the configured credentials
+type AuthError struct {
+	URL  string
+	Code int
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authentication against %s failed with code %d, check the configured credentials", e.URL, e.Code)
+}
+
+// DecodeError is returned when an API response is not valid JSON
+type DecodeError struct {
+	URL string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode response from %s: %s", e.URL, e.Err)
+}
+
+// NotFoundError is returned for endpoints the EMQ node does not serve, e.g.
+// the endpoints of newer or enterprise brokers
+type NotFoundError struct {
+	URL string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("HTTP Request to %s failed with code 404, the endpoint is not served by the node", e.URL)
+}
+
+// StatusError is returned when an API request fails with an unexpected
+// HTTP status code
+type StatusError struct {
+	URL  string
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP Request to %s failed with code %d", e.URL, e.Code)
+}
+
+// RequestError is returned when an API request fails without a response,
+// e.g. on timeouts, DNS failures or refused connections
+type RequestError struct {
+	// Op describes the request, e.g. "get metrics from"
+	Op  string
+	URL string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %s", e.Op, e.URL, e.Err)
+}
+
+// statusError describes a failed API request, pointing out rejected credentials
+func statusError(u *url.URL, code int) error {
+	if isAuthFailure(code) {
+		return &AuthError{URL: displayURL(u), Code: code}
+	}
+	if code == http.StatusNotFound {
+		return &NotFoundError{URL: displayURL(u)}
+	}
+	return &StatusError{URL: displayURL(u), Code: code}
+}
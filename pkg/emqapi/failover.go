@@ -0,0 +1,75 @@
+package emqapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Names of the URL serving the API requests of a client
+const (
+	URLPrimary  = "primary"
+	URLFallback = "fallback"
+)
+
+// baseURL returns the broker URL in use and whether it is the fallback URL
+func (c *HTTPClient) baseURL() (*url.URL, bool) {
+	c.urlMtx.Lock()
+	defer c.urlMtx.Unlock()
+	if c.useFallback {
+		return c.opts.FallbackURL, true
+	}
+	return &c.url, false
+}
+
+// Serving returns URLPrimary or URLFallback depending on which URL of the
+// broker serves the API requests
+func (c *HTTPClient) Serving() string {
+	if _, fallback := c.baseURL(); fallback {
+		return URLFallback
+	}
+	return URLPrimary
+}
+
+// HasFallback reports whether a fallback URL is configured
+func (c *HTTPClient) HasFallback() bool {
+	return c.opts.FallbackURL != nil
+}
+
+// failOver switches from the failed URL to the other one, unless a
+// concurrent request already did
+func (c *HTTPClient) failOver(failed bool) {
+	c.urlMtx.Lock()
+	defer c.urlMtx.Unlock()
+	if c.useFallback == failed {
+		c.useFallback = !failed
+	}
+}
+
+// get requests an API path. When a fallback URL is configured and the URL
+// in use cannot be reached or answers with a server error, the request is
+// repeated against the other URL, which then serves the next requests.
+func (c *HTTPClient) get(ctx context.Context, path string) (*http.Response, *url.URL, error) {
+	_, fallback := c.baseURL()
+	u := c.endpointURL(path)
+	res, err := c.getURL(ctx, u)
+	if c.opts.FallbackURL == nil || err == nil && res.StatusCode < http.StatusInternalServerError {
+		return res, u, err
+	}
+	if err == nil {
+		res.Body.Close()
+	}
+
+	c.failOver(fallback)
+	u = c.endpointURL(path)
+	res, err = c.getURL(ctx, u)
+	return res, u, err
+}
+
+func (c *HTTPClient) getURL(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(prepareRequest(ctx, req))
+}
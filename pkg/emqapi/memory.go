@@ -0,0 +1,68 @@
+package emqapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Bases of the memory units reported by the broker
+const (
+	DecimalUnitBase = 1000
+	BinaryUnitBase  = 1024
+)
+
+var memoryPattern = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*([KMGTP]?)(I?)(B?)\s*$`)
+
+// MemoryString is a memory amount as reported by the broker, which is a
+// JSON string in most API versions and a number of bytes in some
+type MemoryString string
+
+// UnmarshalJSON accepts both strings and numbers
+func (m *MemoryString) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = MemoryString(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("memory value %s is neither a string nor a number", b)
+	}
+	*m = MemoryString(n.String())
+	return nil
+}
+
+// ParseMemory converts a memory amount such as "1073741824", "512.00M",
+// "1.5GB" or "2GiB" to bytes. Units without an explicit "i" use the given
+// base, which is either DecimalUnitBase or BinaryUnitBase.
+func ParseMemory(s string, base float64) (float64, error) {
+	match := memoryPattern.FindStringSubmatch(strings.ToUpper(s))
+	if match == nil {
+		return 0, fmt.Errorf("unknown memory format %q", s)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown memory format %q: %s", s, err)
+	}
+
+	if match[3] != "" {
+		if match[2] == "" {
+			return 0, fmt.Errorf("unknown memory format %q", s)
+		}
+		base = BinaryUnitBase
+	}
+
+	exponent := strings.Index("KMGTP", match[2]) + 1
+	if match[2] == "" {
+		exponent = 0
+	}
+	for i := 0; i < exponent; i++ {
+		value *= base
+	}
+	return value, nil
+}
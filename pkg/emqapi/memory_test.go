@@ -0,0 +1,46 @@
+package emqapi
+
+import "testing"
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		s string
+		// decimal and binary are the bytes under DecimalUnitBase and
+		// BinaryUnitBase
+		decimal, binary float64
+	}{
+		{"1073741824", 1073741824, 1073741824},
+		{"512.00M", 512e6, 512 * 1024 * 1024},
+		{"1.5GB", 1.5e9, 1.5 * 1024 * 1024 * 1024},
+		{"2GiB", 2 * 1024 * 1024 * 1024, 2 * 1024 * 1024 * 1024},
+		{"1.5 gb", 1.5e9, 1.5 * 1024 * 1024 * 1024},
+	}
+	for _, test := range tests {
+		for _, base := range []struct {
+			base float64
+			want float64
+		}{
+			{DecimalUnitBase, test.decimal},
+			{BinaryUnitBase, test.binary},
+		} {
+			got, err := ParseMemory(test.s, base.base)
+			if err != nil {
+				t.Errorf("ParseMemory(%q, %v): %s", test.s, base.base, err)
+				continue
+			}
+			if got != base.want {
+				t.Errorf("ParseMemory(%q, %v) = %v, want %v", test.s, base.base, got, base.want)
+			}
+		}
+	}
+}
+
+func TestParseMemoryMalformed(t *testing.T) {
+	for _, s := range []string{"", "M", "1.5X", "1iB", "-1G", "1.2.3M", "1 G B", "12MB extra"} {
+		for _, base := range []float64{DecimalUnitBase, BinaryUnitBase} {
+			if got, err := ParseMemory(s, base); err == nil {
+				t.Errorf("ParseMemory(%q, %v) = %v, want an error", s, base, got)
+			}
+		}
+	}
+}
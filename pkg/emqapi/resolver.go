@@ -0,0 +1,111 @@
+package emqapi
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNSObserver is notified of the failed lookups of the broker hostname, the
+// observer of the client is also used as DNSObserver if it implements it
+type DNSObserver interface {
+	ObserveDNSLookupFailure(host string, err error)
+}
+
+// Resolver dials the broker for the HTTP transport, caching the addresses
+// of its hostname for TTL in place of the TTL of the DNS records. When a
+// lookup fails the addresses of the last successful one are used until
+// the hostname resolves again.
+type Resolver struct {
+	// TTL is how long the addresses of a hostname are cached, they are
+	// looked up for every connection if 0
+	TTL time.Duration
+
+	dialer net.Dialer
+
+	mtx      sync.Mutex
+	entries  map[string]*dnsEntry
+	observer DNSObserver
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewResolver returns a resolver caching the addresses for ttl
+func NewResolver(ttl time.Duration) *Resolver {
+	return &Resolver{
+		TTL:     ttl,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+// setObserver reports the failed lookups to o
+func (r *Resolver) setObserver(o DNSObserver) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.observer = o
+}
+
+// DialContext connects to the first reachable address of the host of
+// address, it is used as DialContext of the http.Transport of the client
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// lookup returns the cached addresses of host, looking them up again once
+// they expired
+func (r *Resolver) lookup(ctx context.Context, host string) ([]string, error) {
+	r.mtx.Lock()
+	entry, cached := r.entries[host]
+	observer := r.observer
+	r.mtx.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		// canceled scrapes are not failures of the DNS
+		if observer != nil && ctx.Err() == nil {
+			observer.ObserveDNSLookupFailure(host, err)
+		}
+		if cached {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+	if r.TTL > 0 {
+		r.mtx.Lock()
+		r.entries[host] = &dnsEntry{addrs: addrs, expires: time.Now().Add(r.TTL)}
+		r.mtx.Unlock()
+	}
+	return addrs, nil
+}
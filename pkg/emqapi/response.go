@@ -0,0 +1,399 @@
+package emqapi
+
+import "encoding/json"
+
+// NodesResponse is the response of the nodes endpoint
+type NodesResponse struct {
+	Result NodesResponseResult `json:"result"`
+	Code   int                 `json:"code"`
+}
+
+// NodesResponseResult contains the runtime data of a single node
+type NodesResponseResult struct {
+	NodeName    string       `json:"name"`
+	Release     string       `json:"otp_release"`
+	Status      string       `json:"node_status"`
+	MemoryTotal MemoryString `json:"memory_total"`
+	MemoryUsed  MemoryString `json:"memory_used"`
+	// ProcessesAvailable is the process limit of the node in every API
+	// version, not the remaining headroom, see nodesFixtures
+	ProcessesAvailable int    `json:"process_available"`
+	ProcessesUsed      int    `json:"process_used"`
+	MaxFds             int    `json:"max_fds"`
+	UsedFds            *int   `json:"used_fds"`
+	Clients            int    `json:"clients"`
+	Load1              string `json:"load1"`
+	Load5              string `json:"load5"`
+	Load15             string `json:"load15"`
+}
+
+// MetricsResponse is the response of the metrics endpoint
+type MetricsResponse struct {
+	Result MetricsResponseResult `json:"result"`
+	Code   int                   `json:"code"`
+}
+
+// MetricsResponseResult contains the packet and message counters of a node
+type MetricsResponseResult struct {
+	MessagesDropped        int `json:"messages/dropped"`
+	PacketsReceived        int `json:"packets/received"`
+	PacketsPubcompReceived int `json:"packets/pubcomp/received"`
+	PacketsUnsuback        int `json:"packets/unsuback"`
+	PacketsPingresp        int `json:"packets/pingresp"`
+	PacketsPingreq         int `json:"packets/pingreq"`
+	MessagesQos0Sent       int `json:"messages/qos0/sent"`
+	MessagesQos2Received   int `json:"messages/qos2/received"`
+	PacketsPubcompMissed   int `json:"packets/pubcomp/missed"`
+	MessagesRetained       int `json:"messages/retained"`
+	PacketsSuback          int `json:"packets/suback"`
+	BytesSent              int `json:"bytes/sent"`
+	PacketsPubackReceived  int `json:"packets/puback/received"`
+	PacketsPubrecReceived  int `json:"packets/pubrec/received"`
+	MessagesQos2Sent       int `json:"messages/qos2/sent"`
+	PacketsPubrecSent      int `json:"packets/pubrec/sent"`
+	PacketsPubackSent      int `json:"packets/puback/sent"`
+	PacketsPubrelMissed    int `json:"packets/pubrel/missed"`
+	PacketsConnect         int `json:"packets/connect"`
+	MessagesQos1Sent       int `json:"messages/qos1/sent"`
+	PacketsConnack         int `json:"packets/connack"`
+	PacketsPubrelReceived  int `json:"packets/pubrel/received"`
+	PacketsPublishReceived int `json:"packets/publish/received"`
+	BytesReceived          int `json:"bytes/received"`
+	PacketsPubrelSent      int `json:"packets/pubrel/sent"`
+	PacketsPubrecMissed    int `json:"packets/pubrec/missed"`
+	PacketsSent            int `json:"packets/sent"`
+	MessagesQos0Received   int `json:"messages/qos0/received"`
+	PacketsPubcompSent     int `json:"packets/pubcomp/sent"`
+	MessagesReceived       int `json:"messages/received"`
+	MessagesSent           int `json:"messages/sent"`
+	PacketsSubscribe       int `json:"packets/subscribe"`
+	MessagesQos2Dropped    int `json:"messages/qos2/dropped"`
+	PacketsUnsubscribe     int `json:"packets/unsubscribe"`
+	MessagesQos1Received   int `json:"messages/qos1/received"`
+	PacketsDisconnect      int `json:"packets/disconnect"`
+	PacketsPublishSent     int `json:"packets/publish/sent"`
+	PacketsPubackMissed    int `json:"packets/puback/missed"`
+	// The QoS 2 flow and expiry counters are only reported by newer broker versions
+	MessagesExpired                   *int `json:"messages/expired"`
+	MessagesForward                   *int `json:"messages/forward"`
+	MessagesQos2Expired               *int `json:"messages/qos2/expired"`
+	MessagesDroppedAwaitPubrelTimeout *int `json:"messages/dropped/await_pubrel_timeout"`
+	// The authorization counters are only reported by newer broker versions
+	ClientCheckACL            *int `json:"client/check_acl"`
+	ClientACLAllow            *int `json:"client/acl/allow"`
+	ClientACLDeny             *int `json:"client/acl/deny"`
+	ClientACLCacheHit         *int `json:"client/acl/cache_hit"`
+	PacketsPublishAuthError   *int `json:"packets/publish/auth_error"`
+	PacketsSubscribeAuthError *int `json:"packets/subscribe/auth_error"`
+}
+
+// StatsResponse is the response of the stats endpoint
+type StatsResponse struct {
+	Result StatsResponseResult `json:"result"`
+	Code   int                 `json:"code"`
+}
+
+// StatsResponseResult contains the current and maximum counts of a node
+type StatsResponseResult struct {
+	// ConnectionsCount counts network connections, which EMQX 4 separates
+	// from the sessions of disconnected clients. It is not reported by v2.
+	ConnectionsCount *int `json:"connections/count"`
+	ConnectionsMax   *int `json:"connections/max"`
+	// ClientsCount is only reported by v2, newer versions report connections and channels
+	ClientsCount *int `json:"clients/count"`
+	ClientsMax   *int `json:"clients/max"`
+	// ChannelsCount counts the connected clients and the persistent sessions of EMQX 4
+	ChannelsCount           *int `json:"channels/count"`
+	ChannelsMax             *int `json:"channels/max"`
+	RetainedCount           int  `json:"retained/count"`
+	RetainedMax             int  `json:"retained/max"`
+	RoutesCount             int  `json:"routes/count"`
+	RoutesMax               int  `json:"routes/max"`
+	SessionsCount           int  `json:"sessions/count"`
+	SessionsMax             int  `json:"sessions/max"`
+	PersistentSessionsCount *int `json:"sessions/persistent/count"`
+	PersistentSessionsMax   *int `json:"sessions/persistent/max"`
+	SubscribersCount        int  `json:"subscribers/count"`
+	SubscribersMax          int  `json:"subscribers/max"`
+	SubscriptionsCount      int  `json:"subscriptions/count"`
+	SubscriptionsMax        int  `json:"subscriptions/max"`
+	// WildcardSubscriptionsCount is only reported by newer broker versions
+	WildcardSubscriptionsCount *int `json:"subscriptions/wildcard/count"`
+	TopicsCount                int  `json:"topics/count"`
+	TopicsMax                  int  `json:"topics/max"`
+}
+
+// ManagementResponse is the response of the management nodes endpoint
+type ManagementResponse struct {
+	Result []ManagementResponseResult `json:"result"`
+	Code   int                        `json:"code"`
+}
+
+// ManagementResponseResult contains the management data for a single node
+type ManagementResponseResult struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Sysdescr   string `json:"sysdescr"`
+	Uptime     string `json:"uptime"`
+	Datetime   string `json:"datetime"`
+	OtpRelease string `json:"otp_release"`
+	NodeStatus string `json:"node_status"`
+}
+
+// BrokersResponse is the response of the brokers endpoint
+type BrokersResponse struct {
+	Result BrokerInfo `json:"result"`
+	Code   int        `json:"code"`
+}
+
+// BrokerInfo describes the broker running on a node
+type BrokerInfo struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Sysdescr   string `json:"sysdescr"`
+	Uptime     string `json:"uptime"`
+	Datetime   string `json:"datetime"`
+	NodeStatus string `json:"node_status"`
+}
+
+// ListenersResponse is the response of the listeners endpoint
+type ListenersResponse struct {
+	Result []Listener `json:"result"`
+	Code   int        `json:"code"`
+}
+
+// Listener describes a protocol listener of a node
+type Listener struct {
+	Protocol     string
+	ListenOn     string
+	Acceptors    int
+	MaxConns     int
+	CurrentConns int
+	// MaxConnRate is the limit of the connection rate limiter in
+	// connections per second, nil if the broker does not report it
+	MaxConnRate *float64
+	// ShutdownCount counts the closed connections by reason, including
+	// those rejected by the connection rate limiter
+	ShutdownCount map[string]int
+}
+
+// UnmarshalJSON accepts the field names of every API version, v2 names
+// the connection fields after clients
+func (l *Listener) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Protocol       string          `json:"protocol"`
+		ListenOn       string          `json:"listen_on"`
+		Listen         string          `json:"listen"`
+		Acceptors      int             `json:"acceptors"`
+		MaxConns       *int            `json:"max_conns"`
+		MaxClients     int             `json:"max_clients"`
+		CurrentConns   *int            `json:"current_conns"`
+		CurrentClients int             `json:"current_clients"`
+		MaxConnRate    *float64        `json:"max_conn_rate"`
+		ShutdownCount  json.RawMessage `json:"shutdown_count"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*l = Listener{
+		Protocol:     raw.Protocol,
+		ListenOn:     raw.ListenOn,
+		Acceptors:    raw.Acceptors,
+		MaxConns:     raw.MaxClients,
+		CurrentConns: raw.CurrentClients,
+	}
+	if l.ListenOn == "" {
+		l.ListenOn = raw.Listen
+	}
+	if raw.MaxConns != nil {
+		l.MaxConns = *raw.MaxConns
+	}
+	if raw.CurrentConns != nil {
+		l.CurrentConns = *raw.CurrentConns
+	}
+	l.MaxConnRate = raw.MaxConnRate
+	// brokers encode an empty shutdown count as empty list
+	if len(raw.ShutdownCount) > 0 && raw.ShutdownCount[0] == '{' {
+		if err := json.Unmarshal(raw.ShutdownCount, &l.ShutdownCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClientsResponse is one page of the clients endpoint
+type ClientsResponse struct {
+	Result []ClientInfo `json:"result"`
+	Meta   PageMeta     `json:"meta"`
+	Code   int          `json:"code"`
+}
+
+// PageMeta describes the page of a paginated response
+type PageMeta struct {
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+	Count int `json:"count"`
+}
+
+// ClientInfo describes an MQTT client of a node, the clients of persistent
+// sessions are listed while disconnected
+type ClientInfo struct {
+	ClientID           string `json:"clientid"`
+	Username           string `json:"username"`
+	IPAddress          string `json:"ip_address"`
+	Port               int    `json:"port"`
+	Node               string `json:"node"`
+	Connected          bool   `json:"connected"`
+	ConnectedAt        string `json:"connected_at"`
+	ProtoVer           int    `json:"proto_ver"`
+	KeepAlive          int    `json:"keepalive"`
+	CleanStart         bool   `json:"clean_start"`
+	SubscriptionsCount int    `json:"subscriptions_cnt"`
+	MqueueLen          int    `json:"mqueue_len"`
+	Inflight           int    `json:"inflight"`
+	RecvMsg            int    `json:"recv_msg"`
+	SendMsg            int    `json:"send_msg"`
+	RecvOct            int64  `json:"recv_oct"`
+	SendOct            int64  `json:"send_oct"`
+}
+
+// ExhooksResponse is the response of the exhooks endpoint, listing the gRPC
+// servers of the exhook extension
+type ExhooksResponse struct {
+	Result []ExhookServer `json:"result"`
+	Code   int            `json:"code"`
+}
+
+// ExhookServer describes a gRPC server of the exhook extension, the status
+// and metrics are of the whole cluster and, if reported, of every node
+type ExhookServer struct {
+	Name        string              `json:"name"`
+	Enable      bool                `json:"enable"`
+	URL         string              `json:"url"`
+	Status      string              `json:"status"`
+	NodeStatus  []ExhookNodeStatus  `json:"node_status"`
+	Metrics     ExhookMetrics       `json:"metrics"`
+	NodeMetrics []ExhookNodeMetrics `json:"node_metrics"`
+}
+
+// ExhookNodeStatus is the connection status of an exhook server on a node
+type ExhookNodeStatus struct {
+	Node   string `json:"node"`
+	Status string `json:"status"`
+}
+
+// ExhookMetrics counts the hook invocations sent to an exhook server
+type ExhookMetrics struct {
+	Succeed int64 `json:"succeed"`
+	Failed  int64 `json:"failed"`
+}
+
+// ExhookNodeMetrics are the metrics of an exhook server or hook on a node
+type ExhookNodeMetrics struct {
+	Node    string        `json:"node"`
+	Metrics ExhookMetrics `json:"metrics"`
+}
+
+// ExhookHooksResponse is the response of the hooks endpoint of an exhook server
+type ExhookHooksResponse struct {
+	Result []ExhookHook `json:"result"`
+	Code   int          `json:"code"`
+}
+
+// ExhookHook is a hook registered by an exhook server, e.g. client.connect
+type ExhookHook struct {
+	Name        string              `json:"name"`
+	Metrics     ExhookMetrics       `json:"metrics"`
+	NodeMetrics []ExhookNodeMetrics `json:"node_metrics"`
+}
+
+// GatewaysResponse is the response of the gateways endpoint
+type GatewaysResponse struct {
+	Result []Gateway `json:"result"`
+	Code   int       `json:"code"`
+}
+
+// Gateway describes a multi-protocol gateway, e.g. coap, lwm2m, mqttsn or
+// stomp. The fields are nil if the gateway does not report them.
+type Gateway struct {
+	Name               string         `json:"name"`
+	Status             string         `json:"status"`
+	CurrentConnections *int           `json:"current_connections"`
+	MaxConnections     *int           `json:"max_connections"`
+	Metrics            GatewayMetrics `json:"metrics"`
+}
+
+// GatewayMetrics counts the messages of the clients of a gateway
+type GatewayMetrics struct {
+	MessagesReceived *int64 `json:"messages.received"`
+	MessagesSent     *int64 `json:"messages.sent"`
+	MessagesDropped  *int64 `json:"messages.dropped"`
+}
+
+// SlowSubscriptionsResponse is the response of the slow subscriptions endpoint
+type SlowSubscriptionsResponse struct {
+	Result []SlowSubscription `json:"result"`
+	Code   int                `json:"code"`
+}
+
+// SlowSubscription is a subscription whose messages were delivered slowly,
+// Timespan is the latency in milliseconds
+type SlowSubscription struct {
+	ClientID string `json:"clientid"`
+	Node     string `json:"node"`
+	Topic    string `json:"topic"`
+	Timespan int64  `json:"timespan"`
+}
+
+// AlarmsResponse is the response of the activated alarms endpoint
+type AlarmsResponse struct {
+	Result []NodeAlarms `json:"result"`
+	Code   int          `json:"code"`
+}
+
+// NodeAlarms are the activated alarms of a node
+type NodeAlarms struct {
+	Node   string  `json:"node"`
+	Alarms []Alarm `json:"alarms"`
+}
+
+// Alarm is an activated alarm, e.g. conn_congestion/<clientid>/<username>
+type Alarm struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// TopicMetricsResponse is the response of the topic metrics endpoint
+type TopicMetricsResponse struct {
+	Result []TopicMetrics `json:"result"`
+	Code   int            `json:"code"`
+}
+
+// TopicMetrics are the message counters and rates of a registered topic, by
+// dotted key, e.g. messages.in.count or messages.qos1.out.rate
+type TopicMetrics struct {
+	Topic   string             `json:"topic"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// CodeResponse is the response of API requests only returning a result code
+type CodeResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LicenseResponse is the response of the license endpoint of enterprise brokers
+type LicenseResponse struct {
+	Result LicenseInfo `json:"result"`
+	Code   int         `json:"code"`
+}
+
+// LicenseInfo describes the license of an enterprise broker
+type LicenseInfo struct {
+	Customer       string `json:"customer"`
+	Type           string `json:"type"`
+	IssuedAt       string `json:"issued_at"`
+	ExpiryAt       string `json:"expiry_at"`
+	MaxConnections int    `json:"max_connections"`
+}
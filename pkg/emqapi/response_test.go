@@ -0,0 +1,52 @@
+package emqapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// nodesFixtures are responses of the nodes endpoint of each API version. In
+// all of them process_available is the Erlang process limit of the node,
+// erlang:system_info(process_limit), and process_used its process count,
+// so the utilization is process_used / process_available.
+var nodesFixtures = map[string]string{
+	// EMQ 2.3
+	"v2": `{"code":0,"result":{"name":"emq@127.0.0.1","otp_release":"R19/8.3","memory_total":"114.07M","memory_used":"80.27M","process_available":262144,"process_used":306,"max_fds":65536,"clients":3,"node_status":"Running","load1":"0.48","load5":"0.42","load15":"0.40"}}`,
+	// EMQ X 3.2
+	"v3": `{"code":0,"data":{"connections":3,"load1":"0.48","load15":"0.40","load5":"0.42","max_fds":1048576,"memory_total":"122.85M","memory_used":"90.15M","name":"emqx@127.0.0.1","node_status":"Running","otp_release":"R21/10.3.5","process_available":2097152,"process_used":383,"uptime":"1 hours, 2 minutes","version":"v3.2.7"}}`,
+	// EMQ X 4.4
+	"v4": `{"code":0,"data":{"version":"4.4.19","uptime":"2 hours, 3 minutes","process_used":512,"process_available":2097152,"otp_release":"24.3.4.2-2/12.3.2.2","node_status":"Running","node":"emqx@127.0.0.1","max_fds":1048576,"memory_used":"256.00M","memory_total":"512.00M","load5":"0.42","load15":"0.40","load1":"0.48","connections":3}}`,
+}
+
+func TestNodesProcesses(t *testing.T) {
+	want := map[string]struct{ available, used int }{
+		"v2": {262144, 306},
+		"v3": {2097152, 383},
+		"v4": {2097152, 512},
+	}
+	for version, fixture := range nodesFixtures {
+		t.Run(version, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, fixture)
+			}))
+			defer srv.Close()
+
+			u, _ := url.Parse(srv.URL)
+			api, err := FindAPIVersion(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes, err := New(http.DefaultClient, u, "emqx@127.0.0.1", "admin", "public", api, Options{}).Nodes(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := nodes.Result; got.ProcessesAvailable != want[version].available || got.ProcessesUsed != want[version].used {
+				t.Errorf("got %d of %d processes, want %d of %d", got.ProcessesUsed, got.ProcessesAvailable, want[version].used, want[version].available)
+			}
+		})
+	}
+}
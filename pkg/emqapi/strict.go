@@ -0,0 +1,116 @@
+package emqapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownFieldsObserver is notified of the keys of the API responses not
+// mapped by the response structs in strict decode mode, the observer of the
+// client is also used as UnknownFieldsObserver if it implements it
+type UnknownFieldsObserver interface {
+	ObserveUnknownFields(endpoint string, fields []string)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// jsonFields adds the lower-cased JSON names of the fields of the struct
+// type t to fields with their types, like encoding/json they are matched
+// case-insensitively
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			jsonFields(f.Type, fields)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+}
+
+// unknownFields returns the sorted keys of the result of the response b
+// which the type of the Result field of v does not map, as
+// json.Decoder.DisallowUnknownFields would reject them. The objects nested
+// in the result are checked against the structs they are decoded into, as
+// dotted paths, e.g. "parent.key". Values decoded into maps,
+// interfaces or types with a json.Unmarshaler of their own, like Listener,
+// are not checked.
+func (a *APIVersion) unknownFields(b []byte, v interface{}) ([]string, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	result, ok := value.Type().FieldByName("Result")
+	if !ok {
+		return nil, nil
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := a.decode(bytes.NewReader(b), &envelope); err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(envelope.Result)) == 0 {
+		return nil, nil
+	}
+	var data interface{}
+	if err := json.Unmarshal(envelope.Result, &data); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	unknownKeys(result.Type, data, "", found)
+	unknown := make([]string, 0, len(found))
+	for key := range found {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// unknownKeys adds the paths of the keys of data which t does not map to
+// unknown, descending into structs, pointers to them and slices of them
+func unknownKeys(t reflect.Type, data interface{}, path string, unknown map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		items, ok := data.([]interface{})
+		if !ok {
+			return
+		}
+		for _, item := range items {
+			unknownKeys(t.Elem(), item, path, unknown)
+		}
+	case reflect.Struct:
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		jsonFields(t, fields)
+		for key, value := range obj {
+			ft, ok := fields[strings.ToLower(key)]
+			if !ok {
+				unknown[path+key] = true
+				continue
+			}
+			unknownKeys(ft, value, path+key+".", unknown)
+		}
+	}
+}
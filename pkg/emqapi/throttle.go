@@ -0,0 +1,90 @@
+package emqapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The backoff after a throttled request without Retry-After header starts
+// at minThrottleBackoff and doubles with every further throttled request
+const (
+	minThrottleBackoff = 5 * time.Second
+	maxThrottleBackoff = 5 * time.Minute
+)
+
+// ThrottledError is returned when the management API rejects a request with
+// 429 Too Many Requests, and for the requests skipped while backing off
+type ThrottledError struct {
+	URL string
+	// RetryAfter is how long the client backs off
+	RetryAfter time.Duration
+	// Skipped is set if the request was not sent because the client was
+	// still backing off
+	Skipped bool
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Skipped {
+		return fmt.Sprintf("HTTP Request to %s skipped, the EMQ API is throttled for another %s", e.URL, e.RetryAfter)
+	}
+	return fmt.Sprintf("HTTP Request to %s was throttled with code 429, backing off for %s", e.URL, e.RetryAfter)
+}
+
+// checkThrottle returns a ThrottledError while the client backs off
+func (c *HTTPClient) checkThrottle(u *url.URL) error {
+	c.throttleMtx.Lock()
+	defer c.throttleMtx.Unlock()
+	if wait := time.Until(c.throttledUntil); wait > 0 {
+		return &ThrottledError{URL: displayURL(u), RetryAfter: wait.Round(time.Second), Skipped: true}
+	}
+	return nil
+}
+
+// throttle backs off after a 429 response, for the Retry-After of the
+// response if set
+func (c *HTTPClient) throttle(u *url.URL, header http.Header) error {
+	c.throttleMtx.Lock()
+	defer c.throttleMtx.Unlock()
+	backoff, ok := parseRetryAfter(header.Get("Retry-After"))
+	if !ok {
+		switch {
+		case c.throttleBackoff == 0:
+			c.throttleBackoff = minThrottleBackoff
+		case c.throttleBackoff < maxThrottleBackoff:
+			c.throttleBackoff *= 2
+			if c.throttleBackoff > maxThrottleBackoff {
+				c.throttleBackoff = maxThrottleBackoff
+			}
+		}
+		backoff = c.throttleBackoff
+	}
+	c.throttledUntil = time.Now().Add(backoff)
+	return &ThrottledError{URL: displayURL(u), RetryAfter: backoff}
+}
+
+// resetThrottle restarts the backoff after a request was answered
+func (c *HTTPClient) resetThrottle() {
+	c.throttleMtx.Lock()
+	defer c.throttleMtx.Unlock()
+	c.throttleBackoff = 0
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,76 @@
+package emqapi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseURL parses the broker URL, accepting IPv6 zone IDs which are
+// not percent-encoded, e.g. http://[fe80::1%eth0]:8080
+func ParseURL(s string) (*url.URL, error) {
+	if start := strings.Index(s, "["); start >= 0 {
+		if end := strings.Index(s[start:], "]"); end >= 0 {
+			host := s[start : start+end]
+			if i := strings.Index(host, "%"); i >= 0 && !strings.HasPrefix(host[i:], "%25") {
+				host = host[:i] + "%25" + host[i+1:]
+			}
+			s = s[:start] + host + s[start+end:]
+		}
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMQ URL %s: %s", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid EMQ URL %s: scheme must be http or https", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid EMQ URL %s: missing host", s)
+	}
+	return u, nil
+}
+
+// displayURL formats a request URL for logging, keeping the brackets of
+// IPv6 hosts and leaving out any credentials
+func displayURL(u *url.URL) string {
+	d := *u
+	d.User = nil
+	d.RawQuery = ""
+	return d.String()
+}
+
+// endpointURL returns the URL of an API endpoint, keeping the path of the
+// broker URL in use and the API base path as prefix for proxied APIs. The
+// path is escaped, see nodePath, and a query string in it replaces the one
+// of the broker URL.
+func (c *HTTPClient) endpointURL(path string) *url.URL {
+	base, _ := c.baseURL()
+	query := base.RawQuery
+	if i := strings.Index(path, "?"); i >= 0 {
+		query = path[i+1:]
+		path = path[:i]
+	}
+	ref, err := url.Parse(joinURLPath(base.EscapedPath(), c.opts.APIBasePath, path))
+	if err != nil {
+		// custom endpoint paths may contain invalid escapes
+		ref = &url.URL{Path: joinURLPath(base.Path, c.opts.APIBasePath, path)}
+	}
+	ref.RawQuery = query
+	return base.ResolveReference(ref)
+}
+
+func joinURLPath(elems ...string) string {
+	var parts []string
+	for _, e := range elems {
+		if e = strings.Trim(e, "/"); e != "" {
+			parts = append(parts, e)
+		}
+	}
+	path := "/" + strings.Join(parts, "/")
+	if last := elems[len(elems)-1]; strings.HasSuffix(last, "/") && path != "/" {
+		path += "/"
+	}
+	return path
+}
@@ -0,0 +1,282 @@
+// Package expr evaluates the arithmetic expressions of derived metrics,
+// e.g. "emq_node_memory_used_bytes / emq_node_memory_total_bytes"
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed expression of numbers, metric names, the arithmetic
+// operators + - * / and the comparisons == != < <= > >=, which yield 1 if
+// true and 0 otherwise
+type Expr struct {
+	root node
+	vars []string
+}
+
+// node is a node of the syntax tree of an expression
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type number float64
+
+func (n number) eval(map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+type variable string
+
+func (v variable) eval(vars map[string]float64) (float64, error) {
+	value, ok := vars[string(v)]
+	if !ok {
+		return 0, fmt.Errorf("unknown metric %s", string(v))
+	}
+	return value, nil
+}
+
+type negation struct {
+	x node
+}
+
+func (n negation) eval(vars map[string]float64) (float64, error) {
+	x, err := n.x.eval(vars)
+	return -x, err
+}
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (b binary) eval(vars map[string]float64) (float64, error) {
+	x, err := b.x.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	y, err := b.y.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	}
+	var ok bool
+	switch b.op {
+	case "==":
+		ok = x == y
+	case "!=":
+		ok = x != y
+	case "<":
+		ok = x < y
+	case "<=":
+		ok = x <= y
+	case ">":
+		ok = x > y
+	case ">=":
+		ok = x >= y
+	}
+	if ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Parse parses an expression
+func Parse(s string) (*Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vars: make(map[string]bool)}
+	root, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	e := &Expr{root: root}
+	for v := range p.vars {
+		e.vars = append(e.vars, v)
+	}
+	sort.Strings(e.vars)
+	return e, nil
+}
+
+// Vars returns the sorted metric names referenced by the expression
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// Eval evaluates the expression with the values of the metrics, it fails if
+// a referenced metric has no value or on a division by zero
+func (e *Expr) Eval(vars map[string]float64) (float64, error) {
+	return e.root.eval(vars)
+}
+
+// tokenize splits an expression into numbers, names, operators and
+// parentheses
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("+-*/()", c):
+			tokens = append(tokens, string(c))
+			i++
+		case strings.ContainsRune("=!<>", c):
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, s[i:i+2])
+				i += 2
+			} else if c == '<' || c == '>' {
+				tokens = append(tokens, string(c))
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				(s[j] == '+' || s[j] == '-') && j > i && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case isNameChar(c, true):
+			j := i
+			for j < len(s) && isNameChar(rune(s[j]), false) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// isNameChar reports whether c may be part of a metric name
+func isNameChar(c rune, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || !first && c >= '0' && c <= '9'
+}
+
+// parser is a recursive descent parser of the tokens of an expression
+type parser struct {
+	tokens []string
+	pos    int
+	vars   map[string]bool
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) comparison() (node, error) {
+	x, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+		y, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return binary{op: op, x: x, y: y}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) sum() (node, error) {
+	x, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+		y, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) product() (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "*" || op == "/"; op = p.peek() {
+		p.pos++
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.peek() == "-" {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{x: x}, nil
+	}
+	return p.operand()
+}
+
+func (p *parser) operand() (node, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		x, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case isNameChar(rune(token[0]), true):
+		p.vars[token] = true
+		return variable(token), nil
+	}
+	f, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	return number(f), nil
+}
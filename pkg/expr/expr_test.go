@@ -0,0 +1,145 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		expr   string
+		tokens []string
+	}{
+		{"", nil},
+		{"1", []string{"1"}},
+		{" emq_a+emq_b ", []string{"emq_a", "+", "emq_b"}},
+		{"(a - b) * c / d", []string{"(", "a", "-", "b", ")", "*", "c", "/", "d"}},
+		{"a==b!=c<d<=e>f>=g", []string{"a", "==", "b", "!=", "c", "<", "d", "<=", "e", ">", "f", ">=", "g"}},
+		{"1.5e3 + .5 - 2E-2", []string{"1.5e3", "+", ".5", "-", "2E-2"}},
+		{"1e+3+1", []string{"1e+3", "+", "1"}},
+		{"emq:node_up2", []string{"emq:node_up2"}},
+		{"-a", []string{"-", "a"}},
+	}
+	for _, test := range tests {
+		tokens, err := tokenize(test.expr)
+		if err != nil {
+			t.Errorf("tokenize(%q) failed: %s", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("tokenize(%q) = %q, want %q", test.expr, tokens, test.tokens)
+		}
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	for _, s := range []string{"a = b", "!a", "a % b", "a & b", "a,b", "ä"} {
+		if tokens, err := tokenize(s); err == nil {
+			t.Errorf("tokenize(%q) = %q, want an error", s, tokens)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{
+		"emq_used":  25,
+		"emq_total": 100,
+		"emq_zero":  0,
+	}
+	tests := []struct {
+		expr  string
+		value float64
+	}{
+		{"42", 42},
+		{"emq_used / emq_total", 0.25},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"12 / 3 / 2", 2},
+		{"-emq_used", -25},
+		{"--2", 2},
+		{"2 * -3", -6},
+		{"emq_used / emq_total > 0.2", 1},
+		{"emq_used / emq_total > 0.9", 0},
+		{"emq_used + 75 == emq_total", 1},
+		{"emq_used != 25", 0},
+		{"emq_used <= 25", 1},
+		{"emq_used >= 26", 0},
+		{"emq_used < emq_total", 1},
+		{"emq_zero * 5", 0},
+		{"0 / emq_total", 0},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", test.expr, err)
+			continue
+		}
+		value, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("%q failed: %s", test.expr, err)
+			continue
+		}
+		if value != test.value {
+			t.Errorf("%q = %v, want %v", test.expr, value, test.value)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := map[string]float64{
+		"emq_used": 25,
+		"emq_zero": 0,
+	}
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"emq_missing + 1", "unknown metric emq_missing"},
+		{"emq_used / emq_zero", "division by zero"},
+		{"-emq_used / 0", "division by zero"},
+		{"emq_zero / emq_zero", "division by zero"},
+		{"1 / (emq_used - 25) > 0", "division by zero"},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", test.expr, err)
+			continue
+		}
+		value, err := e.Eval(vars)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q = %v, %v, want error %q", test.expr, value, err, test.err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 + 2)",
+		"a b",
+		"a < b < c",
+		"* a",
+		"()",
+		"1..2",
+		"a = b",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	e, err := Parse("emq_b / (emq_a + emq_b) > 0.5 * emq_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars := e.Vars(); !reflect.DeepEqual(vars, []string{"emq_a", "emq_b"}) {
+		t.Errorf("Vars() = %q, want [emq_a emq_b]", vars)
+	}
+}
@@ -0,0 +1,59 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package leader
+
+import (
+	"context"
+	"os"
+	"syscall"
+)
+
+// FileLock is an exclusive flock of a file, shared by replicas running on
+// the same host or volume
+type FileLock struct {
+	path string
+	f    *os.File
+}
+
+// NewFileLock returns the lock of the file at path, which is created if
+// it does not exist
+func NewFileLock(path string) (*FileLock, error) {
+	return &FileLock{path: path}, nil
+}
+
+// TryLock implements Lock
+func (l *FileLock) TryLock(context.Context) (bool, error) {
+	if l.f != nil {
+		return true, nil
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+		return false, err
+	}
+	l.f = f
+	return true, nil
+}
+
+// Unlock implements Lock
+func (l *FileLock) Unlock(context.Context) error {
+	if l.f == nil {
+		return nil
+	}
+	// closing the file releases the lock
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Describe implements Lock
+func (l *FileLock) Describe() string {
+	return "the lock file " + l.path
+}
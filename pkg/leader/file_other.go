@@ -0,0 +1,32 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package leader
+
+import (
+	"context"
+	"errors"
+)
+
+// FileLock is not supported on this platform
+type FileLock struct{}
+
+// NewFileLock fails on platforms without flock
+func NewFileLock(path string) (*FileLock, error) {
+	return nil, errors.New("lock files are not supported on this platform")
+}
+
+// TryLock implements Lock
+func (l *FileLock) TryLock(context.Context) (bool, error) {
+	return false, nil
+}
+
+// Unlock implements Lock
+func (l *FileLock) Unlock(context.Context) error {
+	return nil
+}
+
+// Describe implements Lock
+func (l *FileLock) Describe() string {
+	return "the lock file"
+}
@@ -0,0 +1,96 @@
+// Package leader elects one of several exporter replicas to push the
+// metrics and subscribe to the $SYS topics, while the others stay on standby
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// Lock is held by at most one replica at a time
+type Lock interface {
+	// TryLock acquires or renews the lock and reports whether it is held
+	TryLock(ctx context.Context) (bool, error)
+	// Unlock releases the lock if it is held
+	Unlock(ctx context.Context) error
+	// Describe names the lock in log messages
+	Describe() string
+}
+
+// Elector retries acquiring its lock and reports whether it is held
+type Elector struct {
+	lock  Lock
+	retry time.Duration
+
+	mtx      sync.Mutex
+	leading  bool
+	watchers []func(leading bool)
+}
+
+// NewElector returns an elector renewing or retrying lock every retry
+func NewElector(lock Lock, retry time.Duration) *Elector {
+	return &Elector{lock: lock, retry: retry}
+}
+
+// Leading reports whether this replica holds the lock
+func (e *Elector) Leading() bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.leading
+}
+
+// Watch calls f whenever this replica becomes or stops being the leader.
+// Watchers must be added before Run.
+func (e *Elector) Watch(f func(leading bool)) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.watchers = append(e.watchers, f)
+}
+
+// Run tries to acquire the lock until ctx is done, then releases it
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.retry)
+	defer ticker.Stop()
+	for {
+		leading, err := e.lock.TryLock(ctx)
+		if err != nil {
+			log.Errorf("Failed to acquire %s: %s", e.lock.Describe(), err)
+		}
+		e.set(leading)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			e.set(false)
+			unlockCtx, cancel := context.WithTimeout(context.Background(), e.retry)
+			if err := e.lock.Unlock(unlockCtx); err != nil {
+				log.Errorf("Failed to release %s: %s", e.lock.Describe(), err)
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+func (e *Elector) set(leading bool) {
+	e.mtx.Lock()
+	if e.leading == leading {
+		e.mtx.Unlock()
+		return
+	}
+	e.leading = leading
+	watchers := e.watchers
+	e.mtx.Unlock()
+
+	if leading {
+		log.Infof("Acquired %s, leading", e.lock.Describe())
+	} else {
+		log.Infof("Lost %s, standing by", e.lock.Describe())
+	}
+	for _, f := range watchers {
+		f(leading)
+	}
+}
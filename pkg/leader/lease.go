@@ -0,0 +1,252 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials of the pod's service account
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// microTimeLayout is the layout of the Kubernetes MicroTime fields
+const microTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// LeaseLock is a coordination.k8s.io/v1 Lease, held by the replica named in
+// its holderIdentity until it is not renewed for its duration
+type LeaseLock struct {
+	client    *http.Client
+	url       string
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+	// renewed is the last successful renewal, the lock is considered lost
+	// if it could not be renewed for two thirds of the duration
+	renewed time.Time
+}
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// NewLeaseLock returns the Lease name, as name or namespace/name, held as
+// identity, using the in-cluster credentials of the pod. The namespace
+// defaults to the one of the pod.
+func NewLeaseLock(name, identity string, duration time.Duration) (*LeaseLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("lease %s: not running in a Kubernetes cluster", name)
+	}
+
+	namespace := ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		namespace, name = name[:i], name[i+1:]
+	} else {
+		b, err := ioutil.ReadFile(serviceAccountDir + "namespace")
+		if err != nil {
+			return nil, fmt.Errorf("lease %s: failed to read the namespace: %s", name, err)
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountDir + "ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("lease %s: failed to read the cluster CA: %s", name, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("lease %s: no certificates in the cluster CA", name)
+	}
+
+	return &LeaseLock{
+		client: &http.Client{
+			Timeout:   duration / 3,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		url: fmt.Sprintf("https://%s/apis/coordination.k8s.io/v1/namespaces/%s/leases",
+			net.JoinHostPort(host, port), namespace),
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+		duration:  duration,
+	}, nil
+}
+
+// TryLock implements Lock
+func (l *LeaseLock) TryLock(ctx context.Context) (bool, error) {
+	leading, err := l.tryLock(ctx)
+	if err != nil {
+		// keep leading while the lease cannot have expired for the others
+		return time.Since(l.renewed) < l.duration*2/3, err
+	}
+	if leading {
+		l.renewed = time.Now()
+	} else {
+		// another replica holds the lease, so a later failure must not
+		// count as leading
+		l.renewed = time.Time{}
+	}
+	return leading, nil
+}
+
+func (l *LeaseLock) tryLock(ctx context.Context) (bool, error) {
+	now := time.Now()
+	current, status, err := l.do(ctx, http.MethodGet, l.url+"/"+l.name, nil)
+	if err != nil {
+		return false, err
+	}
+	if status == http.StatusNotFound {
+		_, status, err = l.do(ctx, http.MethodPost, l.url, l.held(nil, now))
+		if err != nil {
+			return false, err
+		}
+		return status == http.StatusCreated, statusError(status, http.StatusCreated, http.StatusConflict)
+	}
+	if status != http.StatusOK {
+		return false, statusError(status, http.StatusOK)
+	}
+
+	if holder := current.Spec.HolderIdentity; holder != "" && holder != l.identity {
+		renewed, err := time.Parse(microTimeLayout, current.Spec.RenewTime)
+		duration := time.Duration(current.Spec.LeaseDurationSeconds) * time.Second
+		if err == nil && now.Before(renewed.Add(duration)) {
+			return false, nil
+		}
+	}
+
+	// the resource version makes the update fail if another replica
+	// updated the lease in the meantime
+	_, status, err = l.do(ctx, http.MethodPut, l.url+"/"+l.name, l.held(current, now))
+	if err != nil {
+		return false, err
+	}
+	return status == http.StatusOK, statusError(status, http.StatusOK, http.StatusConflict)
+}
+
+// held returns the lease held by this replica, updating current if not nil
+func (l *LeaseLock) held(current *lease, now time.Time) *lease {
+	held := &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: l.name, Namespace: l.namespace},
+	}
+	if current != nil {
+		held.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+		held.Spec = current.Spec
+	}
+	if held.Spec.HolderIdentity != l.identity {
+		held.Spec.HolderIdentity = l.identity
+		held.Spec.AcquireTime = now.UTC().Format(microTimeLayout)
+		if current != nil {
+			held.Spec.LeaseTransitions++
+		}
+	}
+	held.Spec.LeaseDurationSeconds = int(l.duration / time.Second)
+	held.Spec.RenewTime = now.UTC().Format(microTimeLayout)
+	return held
+}
+
+// Unlock implements Lock, clearing the holder so a standby replica takes
+// over without waiting for the lease to expire
+func (l *LeaseLock) Unlock(ctx context.Context) error {
+	if l.renewed.IsZero() {
+		return nil
+	}
+	current, status, err := l.do(ctx, http.MethodGet, l.url+"/"+l.name, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return statusError(status, http.StatusOK)
+	}
+	if current.Spec.HolderIdentity != l.identity {
+		return nil
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	_, status, err = l.do(ctx, http.MethodPut, l.url+"/"+l.name, current)
+	if err != nil {
+		return err
+	}
+	l.renewed = time.Time{}
+	return statusError(status, http.StatusOK, http.StatusConflict)
+}
+
+// Describe implements Lock
+func (l *LeaseLock) Describe() string {
+	return "the lease " + l.namespace + "/" + l.name
+}
+
+// do sends a request to the lease API, returning the decoded lease of
+// successful responses and the status code
+func (l *LeaseLock) do(ctx context.Context, method, url string, body *lease) (*lease, int, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, 0, err
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	// bound service account tokens are rotated, so the token is read again
+	token, err := ioutil.ReadFile(serviceAccountDir + "token")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read the service account token: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, resp.StatusCode, nil
+	}
+	var result lease
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode the lease: %s", err)
+	}
+	return &result, resp.StatusCode, nil
+}
+
+// statusError returns an error if status is none of the expected ones
+func statusError(status int, expected ...int) error {
+	for _, s := range expected {
+		if status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("lease API answered with %d", status)
+}
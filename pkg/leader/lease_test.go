@@ -0,0 +1,228 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// leaseAPI is an in-memory Lease API of a single namespace
+type leaseAPI struct {
+	mtx     sync.Mutex
+	lease   *lease
+	version int
+	// fail answers every request with 500 if set
+	fail bool
+}
+
+func (a *leaseAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.fail {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+		if a.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+	case http.MethodPost, http.MethodPut:
+		var l lease
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost && a.lease != nil ||
+			r.Method == http.MethodPut && (a.lease == nil || l.Metadata.ResourceVersion != a.lease.Metadata.ResourceVersion) {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		a.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(a.version)
+		a.lease = &l
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(a.lease)
+}
+
+// holdBy makes identity the holder of a lease renewed now
+func (a *leaseAPI) holdBy(identity string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	now := time.Now().UTC().Format(microTimeLayout)
+	a.version++
+	a.lease = &lease{
+		Metadata: leaseMetadata{Name: "emq-exporter", Namespace: "monitoring", ResourceVersion: strconv.Itoa(a.version)},
+		Spec:     leaseSpec{HolderIdentity: identity, LeaseDurationSeconds: 15, AcquireTime: now, RenewTime: now},
+	}
+}
+
+func (a *leaseAPI) holder() string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.lease == nil {
+		return ""
+	}
+	return a.lease.Spec.HolderIdentity
+}
+
+func (a *leaseAPI) setFail(fail bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.fail = fail
+}
+
+// newTestLeaseLocks starts a Lease API and returns it with a lock of it for
+// each identity
+func newTestLeaseLocks(t *testing.T, identities ...string) (*leaseAPI, []*LeaseLock, func()) {
+	dir, err := ioutil.TempDir("", "lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "token"), []byte("test-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prevDir := serviceAccountDir
+	serviceAccountDir = dir + "/"
+
+	api := &leaseAPI{}
+	srv := httptest.NewServer(api)
+	var locks []*LeaseLock
+	for _, identity := range identities {
+		locks = append(locks, &LeaseLock{
+			client:    srv.Client(),
+			url:       srv.URL + "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases",
+			namespace: "monitoring",
+			name:      "emq-exporter",
+			identity:  identity,
+			duration:  15 * time.Second,
+		})
+	}
+	return api, locks, func() {
+		srv.Close()
+		serviceAccountDir = prevDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLeaseLock(t *testing.T) {
+	api, locks, cleanup := newTestLeaseLocks(t, "a", "b")
+	defer cleanup()
+	a, b := locks[0], locks[1]
+	ctx := context.Background()
+
+	if leading, err := a.TryLock(ctx); !leading || err != nil {
+		t.Fatalf("a acquiring a missing lease: %v, %v", leading, err)
+	}
+	if leading, err := b.TryLock(ctx); leading || err != nil {
+		t.Fatalf("b acquiring the lease of a: %v, %v", leading, err)
+	}
+	if leading, err := a.TryLock(ctx); !leading || err != nil {
+		t.Fatalf("a renewing its lease: %v, %v", leading, err)
+	}
+
+	if err := a.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if holder := api.holder(); holder != "" {
+		t.Fatalf("lease held by %q after unlocking", holder)
+	}
+	if leading, err := b.TryLock(ctx); !leading || err != nil {
+		t.Fatalf("b acquiring the released lease: %v, %v", leading, err)
+	}
+	if holder := api.holder(); holder != "b" {
+		t.Errorf("lease held by %q, want b", holder)
+	}
+}
+
+func TestLeaseLockKeepsLeadingThroughFailures(t *testing.T) {
+	api, locks, cleanup := newTestLeaseLocks(t, "a")
+	defer cleanup()
+	a := locks[0]
+	ctx := context.Background()
+
+	if leading, err := a.TryLock(ctx); !leading || err != nil {
+		t.Fatalf("acquiring the lease: %v, %v", leading, err)
+	}
+	api.setFail(true)
+	if leading, err := a.TryLock(ctx); !leading || err == nil {
+		t.Errorf("renewing against a failing API: %v, %v, want leading with an error", leading, err)
+	}
+}
+
+func TestLeaseLockTakenOver(t *testing.T) {
+	api, locks, cleanup := newTestLeaseLocks(t, "a")
+	defer cleanup()
+	a := locks[0]
+	ctx := context.Background()
+
+	if leading, err := a.TryLock(ctx); !leading || err != nil {
+		t.Fatalf("acquiring the lease: %v, %v", leading, err)
+	}
+	// another replica took the lease over, e.g. after a long pause of a
+	api.holdBy("b")
+	if leading, err := a.TryLock(ctx); leading || err != nil {
+		t.Fatalf("renewing the lease of b: %v, %v", leading, err)
+	}
+	// a failure right after must not make a lead again
+	api.setFail(true)
+	if leading, err := a.TryLock(ctx); leading || err == nil {
+		t.Errorf("trying against a failing API: %v, %v, want not leading with an error", leading, err)
+	}
+}
+
+func TestLeaseLockConflict(t *testing.T) {
+	api, locks, cleanup := newTestLeaseLocks(t, "a")
+	defer cleanup()
+	a := locks[0]
+	ctx := context.Background()
+
+	if leading, err := a.TryLock(ctx); !leading || err != nil {
+		t.Fatalf("acquiring the lease: %v, %v", leading, err)
+	}
+	// the lease was updated between the GET and the PUT of a
+	renewed := false
+	srv := a.client
+	a.client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Method == http.MethodPut && !renewed {
+			renewed = true
+			api.mtx.Lock()
+			api.version++
+			api.lease.Metadata.ResourceVersion = strconv.Itoa(api.version)
+			api.mtx.Unlock()
+		}
+		return srv.Transport.RoundTrip(r)
+	})}
+	if leading, err := a.TryLock(ctx); leading || err != nil {
+		t.Errorf("renewing a concurrently updated lease: %v, %v", leading, err)
+	}
+	api.setFail(true)
+	if leading, _ := a.TryLock(ctx); leading {
+		t.Error("leading after losing the update and a failure")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
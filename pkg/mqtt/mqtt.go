@@ -0,0 +1,380 @@
+// Package mqtt is a minimal MQTT 3.1.1 client subscribing to topics with
+// QoS 0, over TCP, TLS or WebSocket
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types of the fixed header
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// connackErrors are the reasons of the refused connections by return code
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// defaultPorts are the ports of the URL schemes, used if the URL has none
+var defaultPorts = map[string]string{
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+	"ws":    "8083",
+	"wss":   "8084",
+}
+
+// maxKeepAlive is the longest keep alive of the 16 bit field of CONNECT
+const maxKeepAlive = 65535 * time.Second
+
+// writeTimeout bounds every write, so a stalled broker blocks neither the
+// pings nor the DISCONNECT
+var writeTimeout = 10 * time.Second
+
+// Options configures the connection to the broker
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is the interval of the pings, the connection is considered
+	// broken if nothing is received for one and a half of it
+	KeepAlive time.Duration
+	// DialTimeout bounds connecting, including the TLS and WebSocket
+	// handshakes and the CONNECT and SUBSCRIBE exchanges
+	DialTimeout time.Duration
+	TLSConfig   *tls.Config
+}
+
+// Validate checks that the keep alive fits into the CONNECT packet, in
+// whole seconds
+func (o Options) Validate() error {
+	if o.KeepAlive < 0 || o.KeepAlive > maxKeepAlive {
+		return fmt.Errorf("MQTT keep alive %s is not between 0 and %s", o.KeepAlive, maxKeepAlive)
+	}
+	if o.KeepAlive%time.Second != 0 {
+		return fmt.Errorf("MQTT keep alive %s is not a whole number of seconds", o.KeepAlive)
+	}
+	return nil
+}
+
+// Message is a message published to a subscribed topic
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+type client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+
+	wmtx sync.Mutex
+}
+
+// Subscribe connects to the broker at u, subscribes to filters and calls
+// handle for every message received, until ctx is done or the connection
+// fails. The scheme of u is one of tcp, ssl, ws or wss.
+func Subscribe(ctx context.Context, u *url.URL, opts Options, filters []string, handle func(Message)) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	conn, err := dial(ctx, u, opts)
+	if err != nil {
+		return err
+	}
+	c := &client{conn: conn, r: bufio.NewReader(conn), keepAlive: opts.KeepAlive}
+	defer conn.Close()
+
+	if opts.DialTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(opts.DialTimeout))
+	}
+	if err := c.connect(opts); err != nil {
+		return err
+	}
+	if err := c.subscribe(filters); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var tick <-chan time.Time
+		if c.keepAlive > 0 {
+			ticker := time.NewTicker(c.keepAlive)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				c.writePacket(packetDisconnect<<4, nil)
+				conn.Close()
+				return
+			case <-tick:
+				c.writePacket(packetPingreq<<4, nil)
+			}
+		}
+	}()
+
+	for {
+		header, body, err := c.readPacket()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if header>>4 != packetPublish {
+			continue
+		}
+		msg, id, err := parsePublish(header, body)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			if err := c.writePacket(packetPuback<<4, []byte{byte(id >> 8), byte(id)}); err != nil {
+				return err
+			}
+		}
+		handle(msg)
+	}
+}
+
+// dial opens the connection of the scheme of u
+func dial(ctx context.Context, u *url.URL, opts Options) (net.Conn, error) {
+	port, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported MQTT scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	d := &net.Dialer{Timeout: opts.DialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DialTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(opts.DialTimeout))
+	}
+
+	switch u.Scheme {
+	case "ssl", "tls", "mqtts", "wss":
+		cfg := &tls.Config{}
+		if opts.TLSConfig != nil {
+			cfg = opts.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+		wsConn, err := websocketHandshake(conn, u)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = wsConn
+	}
+	return conn, nil
+}
+
+// connect sends the CONNECT packet and waits for its acknowledgement
+func (c *client) connect(opts Options) error {
+	var flags byte = 0x02 // clean session
+	body := appendString(nil, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	keepAlive := int(opts.KeepAlive / time.Second)
+	body = append(body, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = appendString(body, opts.ClientID)
+	if flags&0x80 != 0 {
+		body = appendString(body, opts.Username)
+	}
+	if flags&0x40 != 0 {
+		body = appendString(body, opts.Password)
+	}
+	if err := c.writePacket(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	header, body, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if header>>4 != packetConnack || len(body) != 2 {
+		return errors.New("invalid CONNACK from the broker")
+	}
+	if code := body[1]; code != 0 {
+		reason, ok := connackErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", code)
+		}
+		return fmt.Errorf("connection refused by the broker: %s", reason)
+	}
+	return nil
+}
+
+// subscribe subscribes to filters with QoS 0 and waits for the
+// acknowledgement
+func (c *client) subscribe(filters []string) error {
+	const id = 1
+	body := []byte{0, id}
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0)
+	}
+	if err := c.writePacket(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+
+	for {
+		header, body, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if header>>4 != packetSuback {
+			continue
+		}
+		if len(body) != 2+len(filters) {
+			return errors.New("invalid SUBACK from the broker")
+		}
+		for i, code := range body[2:] {
+			if code == 0x80 {
+				return fmt.Errorf("subscription to %s refused by the broker", filters[i])
+			}
+		}
+		return nil
+	}
+}
+
+// readPacket reads the next packet, failing if nothing was received for one
+// and a half keep alive intervals
+func (c *client) readPacket() (byte, []byte, error) {
+	if c.keepAlive > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+	}
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var length, shift uint
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= uint(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("invalid MQTT remaining length")
+		}
+		shift += 7
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// writePacket writes a packet with the fixed header byte header
+func (c *client) writePacket(header byte, body []byte) error {
+	packet := make([]byte, 0, 5+len(body))
+	packet = append(packet, header)
+	length := len(body)
+	for {
+		b := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// parsePublish returns the message of a PUBLISH packet and its packet
+// identifier, which is 0 for QoS 0
+func parsePublish(header byte, body []byte) (Message, uint16, error) {
+	if len(body) < 2 {
+		return Message{}, 0, errors.New("invalid PUBLISH from the broker")
+	}
+	n := int(body[0])<<8 | int(body[1])
+	if len(body) < 2+n {
+		return Message{}, 0, errors.New("invalid PUBLISH from the broker")
+	}
+	msg := Message{Topic: string(body[2 : 2+n])}
+	body = body[2+n:]
+
+	var id uint16
+	if qos := header >> 1 & 0x03; qos > 0 {
+		if len(body) < 2 {
+			return Message{}, 0, errors.New("invalid PUBLISH from the broker")
+		}
+		id = uint16(body[0])<<8 | uint16(body[1])
+		body = body[2:]
+	}
+	msg.Payload = body
+	return msg, id, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,257 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipe returns the client end and the broker end of a connection, both
+// speaking MQTT packets
+func pipe() (*client, *client) {
+	a, b := net.Pipe()
+	return &client{conn: a, r: bufio.NewReader(a)}, &client{conn: b, r: bufio.NewReader(b)}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	// the remaining length takes 1 to 4 bytes
+	for _, size := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152} {
+		c, broker := pipe()
+		defer c.conn.Close()
+		defer broker.conn.Close()
+		body := bytes.Repeat([]byte{0xa5}, size)
+		errc := make(chan error, 1)
+		go func() { errc <- c.writePacket(packetPublish<<4, body) }()
+
+		header, got, err := broker.readPacket()
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if header != packetPublish<<4 || !bytes.Equal(got, body) {
+			t.Errorf("size %d: got header %#x and %d bytes", size, header, len(got))
+		}
+	}
+}
+
+func TestInvalidRemainingLength(t *testing.T) {
+	c, broker := pipe()
+	defer c.conn.Close()
+	defer broker.conn.Close()
+	go broker.conn.Write([]byte{packetPublish << 4, 0xff, 0xff, 0xff, 0xff, 0x01})
+	if _, _, err := c.readPacket(); err == nil || !strings.Contains(err.Error(), "remaining length") {
+		t.Errorf("got %v, want an invalid remaining length", err)
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	topic := appendString(nil, "$SYS/brokers/emqx@127.0.0.1/uptime")
+
+	msg, id, err := parsePublish(packetPublish<<4, append(topic, "42"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Topic != "$SYS/brokers/emqx@127.0.0.1/uptime" || string(msg.Payload) != "42" || id != 0 {
+		t.Errorf("QoS 0: got %q %q with id %d", msg.Topic, msg.Payload, id)
+	}
+
+	qos1 := append(append(topic, 0x12, 0x34), "42"...)
+	msg, id, err = parsePublish(packetPublish<<4|0x02, qos1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Payload) != "42" || id != 0x1234 {
+		t.Errorf("QoS 1: got %q with id %#x", msg.Payload, id)
+	}
+
+	for _, body := range [][]byte{nil, {0}, {0, 5, 'a'}} {
+		if _, _, err := parsePublish(packetPublish<<4, body); err == nil {
+			t.Errorf("parsePublish(%v) succeeded", body)
+		}
+	}
+	if _, _, err := parsePublish(packetPublish<<4|0x02, topic); err == nil {
+		t.Error("QoS 1 without packet identifier succeeded")
+	}
+}
+
+func TestConnect(t *testing.T) {
+	tests := []struct {
+		connack []byte
+		err     string
+	}{
+		{[]byte{0, 0}, ""},
+		{[]byte{0, 4}, "bad user name or password"},
+		{[]byte{0, 42}, "return code 42"},
+		{[]byte{0}, "invalid CONNACK"},
+	}
+	for _, test := range tests {
+		c, broker := pipe()
+		defer c.conn.Close()
+		defer broker.conn.Close()
+		connect := make(chan []byte, 1)
+		go func() {
+			_, body, err := broker.readPacket()
+			if err != nil {
+				close(connect)
+				return
+			}
+			connect <- body
+			broker.writePacket(packetConnack<<4, test.connack)
+		}()
+
+		err := c.connect(Options{ClientID: "exporter", Username: "user", Password: "secret", KeepAlive: 300 * time.Second})
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("CONNACK %v: got %v, want %q", test.connack, err, test.err)
+		}
+
+		want := appendString(nil, "MQTT")
+		want = append(want, 4, 0xc2, 0x01, 0x2c)
+		want = appendString(want, "exporter")
+		want = appendString(want, "user")
+		want = appendString(want, "secret")
+		if body := <-connect; !bytes.Equal(body, want) {
+			t.Errorf("got CONNECT %v, want %v", body, want)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	filters := []string{"$SYS/#", "sensors/+"}
+	tests := []struct {
+		suback []byte
+		err    string
+	}{
+		{[]byte{0, 1, 0, 0}, ""},
+		{[]byte{0, 1, 0, 0x80}, "subscription to sensors/+ refused"},
+		{[]byte{0, 1, 0}, "invalid SUBACK"},
+	}
+	for _, test := range tests {
+		c, broker := pipe()
+		defer c.conn.Close()
+		defer broker.conn.Close()
+		subscribe := make(chan byte, 1)
+		go func() {
+			header, _, err := broker.readPacket()
+			if err != nil {
+				close(subscribe)
+				return
+			}
+			subscribe <- header
+			// packets before the SUBACK are skipped
+			broker.writePacket(packetPingresp<<4, nil)
+			broker.writePacket(packetSuback<<4, test.suback)
+		}()
+
+		err := c.subscribe(filters)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("SUBACK %v: got %v, want %q", test.suback, err, test.err)
+		}
+		if header := <-subscribe; header != packetSubscribe<<4|0x02 {
+			t.Errorf("got SUBSCRIBE header %#x", header)
+		}
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	defer func(timeout time.Duration) { writeTimeout = timeout }(writeTimeout)
+	writeTimeout = 100 * time.Millisecond
+
+	c, broker := pipe()
+	defer c.conn.Close()
+	defer broker.conn.Close()
+	// the broker never reads
+	errc := make(chan error, 1)
+	go func() { errc <- c.writePacket(packetPingreq<<4, nil) }()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("write to a stalled broker succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("write to a stalled broker did not time out")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, keepAlive := range []time.Duration{0, time.Second, 30 * time.Second, maxKeepAlive} {
+		if err := (Options{KeepAlive: keepAlive}).Validate(); err != nil {
+			t.Errorf("keep alive %s: %s", keepAlive, err)
+		}
+	}
+	for _, keepAlive := range []time.Duration{-time.Second, 1500 * time.Millisecond, maxKeepAlive + time.Second, 24 * time.Hour} {
+		if err := (Options{KeepAlive: keepAlive}).Validate(); err == nil {
+			t.Errorf("keep alive %s is valid", keepAlive)
+		}
+	}
+}
+
+func TestSubscribeAcknowledgesQoS1(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the broker publishes a QoS 1 message and reports the packets
+	// received afterwards
+	received := make(chan []byte, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		broker := &client{conn: conn, r: bufio.NewReader(conn)}
+		broker.readPacket()
+		broker.writePacket(packetConnack<<4, []byte{0, 0})
+		broker.readPacket()
+		broker.writePacket(packetSuback<<4, []byte{0, 1, 0})
+		publish := append(appendString(nil, "$SYS/brokers"), 0, 7)
+		broker.writePacket(packetPublish<<4|0x02, append(publish, "emqx@127.0.0.1"...))
+		for {
+			header, body, err := broker.readPacket()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- append([]byte{header}, body...)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs := make(chan Message, 1)
+	errc := make(chan error, 1)
+	u := &url.URL{Scheme: "tcp", Host: l.Addr().String()}
+	go func() {
+		errc <- Subscribe(ctx, u, Options{ClientID: "exporter", DialTimeout: time.Second}, []string{"$SYS/#"}, func(msg Message) {
+			msgs <- msg
+		})
+	}()
+
+	select {
+	case msg := <-msgs:
+		if msg.Topic != "$SYS/brokers" || string(msg.Payload) != "emqx@127.0.0.1" {
+			t.Errorf("got message %q %q", msg.Topic, msg.Payload)
+		}
+	case err := <-errc:
+		t.Fatal(err)
+	}
+	if puback := <-received; !bytes.Equal(puback, []byte{packetPuback << 4, 0, 7}) {
+		t.Errorf("got %v, want a PUBACK of packet 7", puback)
+	}
+
+	cancel()
+	if disconnect := <-received; !bytes.Equal(disconnect, []byte{packetDisconnect << 4}) {
+		t.Errorf("got %v, want a DISCONNECT", disconnect)
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("got %v after cancelling", err)
+	}
+}
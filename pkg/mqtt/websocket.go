@@ -0,0 +1,182 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the key of the handshake, RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// websocketConn carries the MQTT stream in binary WebSocket frames
+type websocketConn struct {
+	net.Conn
+	r *bufio.Reader
+	// remaining is the unread payload of the current data frame
+	remaining int64
+
+	wmtx sync.Mutex
+}
+
+// websocketHandshake upgrades conn to a WebSocket with the mqtt subprotocol,
+// on the path of u or /mqtt, the path of the EMQ WebSocket listener
+func websocketHandshake(conn net.Conn, u *url.URL) (net.Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	target := *u
+	target.Scheme = "http"
+	if target.Path == "" {
+		target.Path = "/mqtt"
+	}
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", "mqtt")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("WebSocket upgrade of %s refused with %s", target.Path, resp.Status)
+	}
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+		return nil, errors.New("invalid Sec-WebSocket-Accept from the broker")
+	}
+	return &websocketConn{Conn: conn, r: r}, nil
+}
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers until the next data frame, answering pings
+func (c *websocketConn) nextFrame() error {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	if header[1]&0x80 != 0 {
+		return errors.New("masked WebSocket frame from the broker")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	switch header[0] & 0x0f {
+	case opContinuation, opText, opBinary:
+		c.remaining = length
+		return nil
+	case opClose:
+		return io.EOF
+	case opPing:
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return err
+		}
+		// the pong is written by the reader, outside of writePacket
+		c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return c.writeFrame(opPong, payload)
+	default:
+		_, err := io.CopyN(ioutil.Discard, c.r, length)
+		return err
+	}
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame writes a single masked frame, as required of clients
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, 0x80|127)
+		frame = append(frame, ext[:]...)
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
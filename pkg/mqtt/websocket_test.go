@@ -0,0 +1,164 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// readClientFrame reads a frame of the client, which must be masked
+func readClientFrame(r io.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked frame from the client")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	io.ReadFull(r, mask[:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0], payload, nil
+}
+
+// serverFrame returns an unmasked frame of the broker
+func serverFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, 127), ext[:]...)
+	}
+	return append(frame, payload...)
+}
+
+func TestWebsocketWrite(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xffff, 0x10000} {
+		a, b := net.Pipe()
+		c := &websocketConn{Conn: a, r: bufio.NewReader(a)}
+		payload := bytes.Repeat([]byte{0x5a}, size)
+		go c.Write(payload)
+
+		opcode, got, err := readClientFrame(b)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if opcode != 0x80|opBinary || !bytes.Equal(got, payload) {
+			t.Errorf("size %d: got opcode %#x and %d bytes", size, opcode, len(got))
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestWebsocketRead(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	c := &websocketConn{Conn: a, r: bufio.NewReader(a)}
+
+	large := bytes.Repeat([]byte{0x5a}, 0x10000)
+	go func() {
+		b.Write(serverFrame(opBinary, []byte("abc")))
+		b.Write(serverFrame(opPing, []byte("ping")))
+		b.Write(serverFrame(opContinuation, []byte("def")))
+		b.Write(serverFrame(opBinary, large))
+		b.Write(serverFrame(opClose, nil))
+	}()
+	pong := make(chan []byte, 1)
+	go func() {
+		_, payload, _ := readClientFrame(b)
+		pong <- payload
+	}()
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "abc" {
+		t.Fatalf("got %q, %v", buf, err)
+	}
+	// the ping is answered while reading the next data frame
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "def" {
+		t.Fatalf("got %q, %v", buf, err)
+	}
+	if payload := <-pong; string(payload) != "ping" {
+		t.Errorf("got pong %q", payload)
+	}
+	got := make([]byte, len(large))
+	if _, err := io.ReadFull(c, got); err != nil || !bytes.Equal(got, large) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+	if _, err := c.Read(buf); err != io.EOF {
+		t.Errorf("got %v after the close frame, want EOF", err)
+	}
+}
+
+func TestWebsocketMaskedFrame(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	c := &websocketConn{Conn: a, r: bufio.NewReader(a)}
+	go b.Write([]byte{0x80 | opBinary, 0x80 | 1, 0, 0, 0, 0, 'a'})
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Error("masked frame from the broker accepted")
+	}
+}
+
+func TestWebsocketHandshake(t *testing.T) {
+	for _, accept := range []bool{true, false} {
+		a, b := net.Pipe()
+		go func() {
+			req, err := http.ReadRequest(bufio.NewReader(b))
+			if err != nil {
+				return
+			}
+			if req.URL.Path != "/mqtt" || req.Header.Get("Sec-WebSocket-Protocol") != "mqtt" {
+				t.Errorf("got request of %s with protocol %q", req.URL.Path, req.Header.Get("Sec-WebSocket-Protocol"))
+			}
+			key := "invalid"
+			if accept {
+				sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+				key = base64.StdEncoding.EncodeToString(sum[:])
+			}
+			io.WriteString(b, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: "+key+"\r\n\r\n")
+		}()
+
+		_, err := websocketHandshake(a, &url.URL{Scheme: "ws", Host: "emq:8083"})
+		if accept && err != nil {
+			t.Errorf("handshake failed: %s", err)
+		}
+		if !accept && err == nil {
+			t.Error("invalid Sec-WebSocket-Accept accepted")
+		}
+		a.Close()
+		b.Close()
+	}
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+type contextKey int
+
+const (
+	traceIDKey contextKey = iota
+	recorderKey
+	spanKey
+)
+
+// Span is a timed operation of a scrape
+type Span struct {
+	name     string
+	kind     int
+	traceID  string
+	spanID   string
+	parentID string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	err      error
+}
+
+// Recorder collects the spans of a single scrape
+type Recorder struct {
+	mtx   sync.Mutex
+	spans []*Span
+}
+
+// Spans returns the spans recorded so far
+func (r *Recorder) Spans() []*Span {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]*Span{}, r.spans...)
+}
+
+// WithTraceID returns a copy of ctx carrying the trace ID of a scrape
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// TraceID returns the trace ID carried by ctx, or an empty string
+func TraceID(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey).(string)
+	return traceID
+}
+
+// WithRecorder returns a copy of ctx whose spans are recorded by r
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey, r)
+}
+
+// Logger returns a logger annotated with the trace ID carried by ctx
+func Logger(ctx context.Context) log.Logger {
+	return log.With("trace_id", TraceID(ctx))
+}
+
+// StartSpan starts a child of the span carried by ctx, or a root span if
+// there is none, and returns a copy of ctx carrying the new span.
+// The span is nil when ctx has no recorder, all span methods accept nil.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	r, _ := ctx.Value(recorderKey).(*Recorder)
+	if r == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		name:    name,
+		kind:    kind,
+		traceID: TraceID(ctx),
+		spanID:  newSpanID(),
+		start:   time.Now(),
+		attrs:   make(map[string]string),
+	}
+	if parent, ok := ctx.Value(spanKey).(*Span); ok {
+		s.parentID = parent.spanID
+	}
+
+	r.mtx.Lock()
+	r.spans = append(r.spans, s)
+	r.mtx.Unlock()
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// SetAttribute sets a string attribute of the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// Finish ends the span, marking it as failed if err is not nil
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.err = err
+	s.end = time.Now()
+}
+
+// NewTraceID returns a random 16 byte ID, compatible with OpenTelemetry trace IDs
+func NewTraceID() string {
+	return newRandomHex(16)
+}
+
+func newSpanID() string {
+	return newRandomHex(8)
+}
+
+func newRandomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("failed to generate random ID: %s", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,143 @@
+// Package tracing records the spans of a scrape and exports them to an
+// OpenTelemetry collector
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// Span kinds, as defined by OpenTelemetry
+const (
+	SpanKindInternal = 1
+	SpanKindClient   = 3
+
+	otlpStatusError = 2
+)
+
+// Tracer exports the spans of a scrape to an OTLP/HTTP endpoint using the JSON encoding
+type Tracer struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewTracer returns a tracer sending spans to the given OTLP/HTTP endpoint,
+// the default traces path is used when the endpoint has none
+func NewTracer(endpoint string) (*Tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing endpoint %s: %s", endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return &Tracer{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: u.String(),
+	}, nil
+}
+
+// Export sends the finished spans in the background
+func (t *Tracer) Export(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+	go func() {
+		if err := t.send(spans); err != nil {
+			log.Errorf("failed to export spans to %s: %s", t.endpoint, err)
+		}
+	}()
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+func newOTLPKeyValue(key, value string) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	kv.Value.StringValue = value
+	return kv
+}
+
+func (t *Tracer) send(spans []*Span) error {
+	var otlpSpans []otlpSpan
+	for _, s := range spans {
+		if s.end.IsZero() {
+			continue
+		}
+		out := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for k, v := range s.attrs {
+			out.Attributes = append(out.Attributes, newOTLPKeyValue(k, v))
+		}
+		if s.err != nil {
+			out.Status = otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+		}
+		otlpSpans = append(otlpSpans, out)
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpKeyValue{newOTLPKeyValue("service.name", "emq_exporter")},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "emq_exporter"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// pusher periodically pushes the gathered metrics to a Pushgateway, or to a
+// remote write endpoint
+type pusher struct {
+	url    string
+	client *http.Client
+	// remoteWrite sends a remote write WriteRequest in place of the text
+	// format, with the job label added to every series
+	remoteWrite bool
+	job         string
+	// targets are gathered with the API requests bound to the push
+	// interval, base in any case
+	targets *targetsGatherer
+	base    prometheus.Gatherer
+	// onlyChanged skips the families whose samples did not change since the
+	// last successful push. The Pushgateway replaces pushed families as a
+	// whole, so a family is sent with all its samples when any changed, and
+	// the remote writer does the same to keep the series of a family in step.
+	onlyChanged bool
+	last        map[string]uint64
+	// fullEvery pushes every family every fullEvery pushes, so a restarted
+	// Pushgateway without persistence gets the unchanged families back, and
+	// the series written remotely do not go stale
+	fullEvery int
+	pushes    int
+	auth      pushAuth
+	// leading reports whether this replica pushes, always if nil
+	leading func() bool
+}
+
+// pushAuth holds the credentials sent with every push
+type pushAuth struct {
+	Username    string
+	Password    string
+	BearerToken string
+	// TenantID is sent as X-Scope-OrgID header to multi-tenant backends
+	// such as Cortex and Mimir
+	TenantID string
+}
+
+func newPusher(pushURL, job string, targets *targetsGatherer, base prometheus.Gatherer, onlyChanged bool, fullEvery int, auth pushAuth) *pusher {
+	return &pusher{
+		url:         strings.TrimRight(pushURL, "/") + "/metrics/job/" + url.PathEscape(job),
+		client:      &http.Client{Timeout: 30 * time.Second},
+		targets:     targets,
+		base:        base,
+		onlyChanged: onlyChanged,
+		last:        make(map[string]uint64),
+		fullEvery:   fullEvery,
+		auth:        auth,
+	}
+}
+
+// newRemoteWriter returns a pusher sending the metrics to a remote write
+// endpoint, e.g. of Cortex, Mimir or Grafana Cloud
+func newRemoteWriter(writeURL, job string, targets *targetsGatherer, base prometheus.Gatherer, onlyChanged bool, fullEvery int, auth pushAuth) *pusher {
+	return &pusher{
+		url:         writeURL,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		remoteWrite: true,
+		job:         job,
+		targets:     targets,
+		base:        base,
+		onlyChanged: onlyChanged,
+		last:        make(map[string]uint64),
+		fullEvery:   fullEvery,
+		auth:        auth,
+	}
+}
+
+// run pushes the metrics every interval until quit is closed
+func (p *pusher) run(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if p.leading == nil || p.leading() {
+			// a broker which stops answering must not hold up the next push
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := p.push(ctx); err != nil {
+				log.Errorf("Failed to push metrics: %s", err)
+				// the Pushgateway may have lost the families, e.g. when it
+				// restarted, so everything is pushed again
+				p.last = make(map[string]uint64)
+			}
+			cancel()
+		} else {
+			// the leader pushed in the meantime, so everything is pushed
+			// again after taking over
+			p.last = make(map[string]uint64)
+		}
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (p *pusher) push(ctx context.Context) error {
+	if p.fullEvery > 0 && p.pushes >= p.fullEvery {
+		p.last = make(map[string]uint64)
+	}
+	if len(p.last) == 0 {
+		p.pushes = 0
+	}
+	p.pushes++
+
+	gatherer := prometheus.Gatherers{
+		p.base,
+		gathererFunc(func() ([]*dto.MetricFamily, error) {
+			return p.targets.GatherContext(ctx)
+		}),
+	}
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[string]uint64, len(mfs))
+	changed := mfs[:0]
+	for _, mf := range mfs {
+		if p.onlyChanged {
+			h, err := familyHash(mf)
+			if err != nil {
+				return err
+			}
+			hashes[mf.GetName()] = h
+			if last, ok := p.last[mf.GetName()]; ok && last == h {
+				continue
+			}
+		}
+		changed = append(changed, mf)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if p.remoteWrite {
+		err = p.write(ctx, changed)
+	} else {
+		err = p.pushText(ctx, changed)
+	}
+	if err != nil {
+		return err
+	}
+	for name, h := range hashes {
+		p.last[name] = h
+	}
+	return nil
+}
+
+// pushText sends the families to the Pushgateway in the text format
+func (p *pusher) pushText(ctx context.Context, mfs []*dto.MetricFamily) error {
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			return err
+		}
+	}
+
+	// POST only replaces the pushed families, keeping the unchanged ones
+	req, err := http.NewRequest("POST", p.url, &buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", string(expfmt.FmtText))
+	p.auth.apply(req)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP Request to %s failed with code %d", p.url, res.StatusCode)
+	}
+	return nil
+}
+
+// write sends the families to the remote write endpoint
+func (p *pusher) write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	body, err := encodeWriteRequest(mfs, p.job, time.Now().UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	p.auth.apply(req)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP Request to %s failed with code %d", p.url, res.StatusCode)
+	}
+	return nil
+}
+
+// apply adds the credentials to a push request
+func (a pushAuth) apply(req *http.Request) {
+	switch {
+	case a.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	if a.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", a.TenantID)
+	}
+}
+
+// familyHash hashes the samples of a metric family
+func familyHash(mf *dto.MetricFamily) (uint64, error) {
+	b, err := proto.Marshal(mf)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64(), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// remoteWriteVersion is the version of the remote write protocol spoken
+const remoteWriteVersion = "0.1.0"
+
+// label is a label pair of a remote write time series
+type label struct {
+	name, value string
+}
+
+// encodeWriteRequest encodes the families as snappy compressed remote write
+// WriteRequest, with the job label added to every series. Samples without a
+// timestamp get nowMs.
+func encodeWriteRequest(mfs []*dto.MetricFamily, job string, nowMs int64) ([]byte, error) {
+	w := &writeRequestEncoder{buf: proto.NewBuffer(nil), job: job}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			ts := nowMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			labels := m.GetLabel()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				w.series(name, labels, nil, m.GetCounter().GetValue(), ts)
+			case dto.MetricType_GAUGE:
+				w.series(name, labels, nil, m.GetGauge().GetValue(), ts)
+			case dto.MetricType_UNTYPED:
+				w.series(name, labels, nil, m.GetUntyped().GetValue(), ts)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					w.series(name, labels, &label{"quantile", formatFloat(q.GetQuantile())}, q.GetValue(), ts)
+				}
+				w.series(name+"_sum", labels, nil, s.GetSampleSum(), ts)
+				w.series(name+"_count", labels, nil, float64(s.GetSampleCount()), ts)
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				infSeen := false
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						infSeen = true
+					}
+					w.series(name+"_bucket", labels, &label{"le", formatFloat(b.GetUpperBound())}, float64(b.GetCumulativeCount()), ts)
+				}
+				if !infSeen {
+					w.series(name+"_bucket", labels, &label{"le", "+Inf"}, float64(h.GetSampleCount()), ts)
+				}
+				w.series(name+"_sum", labels, nil, h.GetSampleSum(), ts)
+				w.series(name+"_count", labels, nil, float64(h.GetSampleCount()), ts)
+			}
+			if w.err != nil {
+				return nil, w.err
+			}
+		}
+	}
+	return snappy.Encode(nil, w.buf.Bytes()), nil
+}
+
+// writeRequestEncoder writes the protobuf encoding of a WriteRequest, whose
+// only field is the repeated TimeSeries timeseries = 1
+type writeRequestEncoder struct {
+	buf *proto.Buffer
+	job string
+	err error
+}
+
+// series appends a time series with a single sample
+func (w *writeRequestEncoder) series(name string, pairs []*dto.LabelPair, extra *label, value float64, ts int64) {
+	labels := make([]label, 0, len(pairs)+3)
+	labels = append(labels, label{"__name__", name})
+	hasJob := false
+	for _, p := range pairs {
+		if p.GetName() == "job" {
+			hasJob = true
+		}
+		labels = append(labels, label{p.GetName(), p.GetValue()})
+	}
+	if extra != nil {
+		labels = append(labels, *extra)
+	}
+	if !hasJob && w.job != "" {
+		labels = append(labels, label{"job", w.job})
+	}
+	// the receivers require the labels sorted by name
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+	// TimeSeries: repeated Label labels = 1, repeated Sample samples = 2
+	series := proto.NewBuffer(nil)
+	for _, l := range labels {
+		// Label: string name = 1, string value = 2
+		pair := proto.NewBuffer(nil)
+		w.check(pair.EncodeVarint(1<<3 | 2))
+		w.check(pair.EncodeStringBytes(l.name))
+		w.check(pair.EncodeVarint(2<<3 | 2))
+		w.check(pair.EncodeStringBytes(l.value))
+		w.check(series.EncodeVarint(1<<3 | 2))
+		w.check(series.EncodeRawBytes(pair.Bytes()))
+	}
+	// Sample: double value = 1, int64 timestamp = 2
+	sample := proto.NewBuffer(nil)
+	w.check(sample.EncodeVarint(1<<3 | 1))
+	w.check(sample.EncodeFixed64(math.Float64bits(value)))
+	w.check(sample.EncodeVarint(2<<3 | 0))
+	w.check(sample.EncodeVarint(uint64(ts)))
+	w.check(series.EncodeVarint(2<<3 | 2))
+	w.check(series.EncodeRawBytes(sample.Bytes()))
+
+	w.check(w.buf.EncodeVarint(1<<3 | 2))
+	w.check(w.buf.EncodeRawBytes(series.Bytes()))
+}
+
+func (w *writeRequestEncoder) check(err error) {
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// formatFloat formats the quantile and le labels like the text format
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
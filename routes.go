@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	routesName       = prometheus.BuildFQName(collector.Namespace, "stats", "routes")
+	inconsistentName = prometheus.BuildFQName(collector.Namespace, "cluster", "route_table_inconsistent")
+)
+
+// routeConsistency compares the route counts of the scraped nodes, which
+// are the same on every member of a healthy cluster. It returns a family
+// set to 1 when they diverge by more than threshold routes, nil if less
+// than two nodes reported their routes.
+func routeConsistency(families []*dto.MetricFamily, threshold int) *dto.MetricFamily {
+	var counts []float64
+	for _, mf := range families {
+		if mf.GetName() != routesName {
+			continue
+		}
+		for _, m := range mf.Metric {
+			counts = append(counts, m.GetGauge().GetValue())
+		}
+	}
+	if len(counts) < 2 {
+		return nil
+	}
+
+	min, max := counts[0], counts[0]
+	for _, c := range counts[1:] {
+		if c < min {
+			min = c
+		}
+		if c > max {
+			max = c
+		}
+	}
+	var value float64
+	if max-min > float64(threshold) {
+		value = 1
+	}
+
+	return &dto.MetricFamily{
+		Name: proto.String(inconsistentName),
+		Help: proto.String("Whether the route counts of the scraped nodes diverge by more than the threshold."),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Gauge: &dto.Gauge{Value: proto.Float64(value)}},
+		},
+	}
+}
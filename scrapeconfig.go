@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/larseen/emq_exporter/pkg/config"
+)
+
+var scrapeConfigTemplate = template.Must(template.New("scrape_config").Parse(`scrape_configs:
+  - job_name: {{ .JobName }}
+    metrics_path: {{ .MetricsPath }}
+{{- if .FileSD }}
+    file_sd_configs:
+      - files:
+          - {{ .FileSD }}
+{{- else }}
+    static_configs:
+      - targets:
+{{- range .Targets }}
+          - {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Probe }}
+    relabel_configs:
+      - source_labels: [__address__]
+        target_label: __param_target
+      - source_labels: [__param_target]
+        target_label: instance
+      - target_label: __address__
+        replacement: {{ .Address }}
+{{- end }}
+`))
+
+// scrapeConfig holds the parameters of a generated Prometheus scrape config
+type scrapeConfig struct {
+	JobName     string
+	MetricsPath string
+	Address     string
+	// Probe scrapes every target separately through the target URL parameter
+	Probe   bool
+	Targets []string
+	// FileSD is the path of a file_sd targets file used in place of static targets
+	FileSD string
+}
+
+// exporterAddress returns the address Prometheus reaches the exporter on,
+// using localhost when the listen address has no host
+func exporterAddress(listenAddress string) string {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return listenAddress
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// newScrapeConfig builds the scrape config for the configured targets, only
+// the targets named in filter are included when it is not empty
+func newScrapeConfig(cfg *config.Config, filter string, address string, probe bool) (*scrapeConfig, error) {
+	sc := &scrapeConfig{
+		JobName:     "emq",
+		MetricsPath: *metricsPath,
+		Address:     address,
+		Probe:       probe,
+	}
+	if !probe {
+		sc.Targets = []string{address}
+		return sc, nil
+	}
+
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("probe mode requires targets in the configuration file")
+	}
+	wanted := make(map[string]bool)
+	for _, name := range strings.Split(filter, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+	for _, t := range cfg.Targets {
+		if len(wanted) == 0 || wanted[t.Name] {
+			sc.Targets = append(sc.Targets, t.Name)
+			delete(wanted, t.Name)
+		}
+	}
+	if len(wanted) > 0 {
+		var missing []string
+		for name := range wanted {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("targets not configured: %s", strings.Join(missing, ", "))
+	}
+	return sc, nil
+}
+
+// writeScrapeConfig prints the scrape config to w and writes the file_sd
+// targets file if one is configured
+func writeScrapeConfig(w io.Writer, sc *scrapeConfig) error {
+	if sc.FileSD != "" {
+		b, err := json.MarshalIndent([]map[string]interface{}{
+			{"targets": sc.Targets},
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(sc.FileSD, append(b, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write targets file %s: %s", sc.FileSD, err)
+		}
+	}
+	return scrapeConfigTemplate.Execute(w, sc)
+}
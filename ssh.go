@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTunnelTimeout bounds the connection to the SSH host
+const sshTunnelTimeout = 15 * time.Second
+
+// sshKeepAliveInterval is the interval of the keepalive requests, the
+// connection is dropped when one is not answered within it
+const sshKeepAliveInterval = 15 * time.Second
+
+// sshTunnel forwards a local port to the EMQ API through the SSH host, the
+// connection is opened again whenever it is lost
+type sshTunnel struct {
+	cfg          config.SSHConfig
+	addr         string
+	clientConfig *ssh.ClientConfig
+	// agentAuth holds the connection to the SSH agent while connecting
+	agentAuth *sshAgent
+	remote    string
+	listener  net.Listener
+
+	mtx    sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// sshTunnels are the running tunnels by jump host, credentials and remote
+// address, they are kept across configuration reloads
+var sshTunnels = struct {
+	sync.Mutex
+	m map[string]*sshTunnel
+}{m: make(map[string]*sshTunnel)}
+
+// sshTunnelKey identifies the tunnel to remote through the SSH host of cfg
+func sshTunnelKey(cfg config.SSHConfig, remote string) string {
+	return cfg.User + "@" + cfg.Host + "|" + cfg.KeyFile + "|" + cfg.KnownHostsFile + "|" + remote
+}
+
+// openSSHTunnel returns the local address forwarded to remote through the
+// SSH host of cfg, starting the tunnel if it is not running yet
+func openSSHTunnel(cfg config.SSHConfig, remote string) (string, error) {
+	key := sshTunnelKey(cfg, remote)
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	if t, ok := sshTunnels.m[key]; ok {
+		return t.listener.Addr().String(), nil
+	}
+
+	clientConfig, agentAuth, err := sshClientConfig(cfg)
+	if err != nil {
+		return "", fmt.Errorf("SSH tunnel to %s: %s", cfg.Host, err)
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	t := &sshTunnel{cfg: cfg, addr: addr, clientConfig: clientConfig, agentAuth: agentAuth, remote: remote}
+	// a host that cannot be reached or rejects the credentials fails the
+	// configuration rather than every scrape
+	if _, err := t.connect(); err != nil {
+		return "", err
+	}
+	t.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Forwarding %s to %s through %s", t.listener.Addr(), t.remote, t.cfg.Host)
+	go t.serve()
+	sshTunnels.m[key] = t
+	return t.listener.Addr().String(), nil
+}
+
+// closeUnusedSSHTunnels stops the tunnels that none of the targets of ts is
+// forwarded through, the ones of removed targets after a reload
+func closeUnusedSSHTunnels(ts *targetSet) {
+	used := make(map[string]bool, len(ts.targets))
+	for _, t := range ts.targets {
+		if t.sshTunnel != "" {
+			used[t.sshTunnel] = true
+		}
+	}
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	for key, t := range sshTunnels.m {
+		if !used[key] {
+			log.Infof("Closing the SSH tunnel to %s through %s", t.remote, t.cfg.Host)
+			t.close()
+			delete(sshTunnels.m, key)
+		}
+	}
+}
+
+// sshAgent provides the keys of the SSH agent, it is dialled for every
+// authentication and the connection is closed once connected
+type sshAgent struct {
+	sock string
+	conn net.Conn
+}
+
+func (a *sshAgent) signers() ([]ssh.Signer, error) {
+	conn, err := net.Dial("unix", a.sock)
+	if err != nil {
+		log.Warnf("Failed to connect to the SSH agent: %s", err)
+		return nil, err
+	}
+	a.conn = conn
+	return agent.NewClient(conn).Signers()
+}
+
+func (a *sshAgent) close() {
+	if a.conn != nil {
+		a.conn.Close()
+		a.conn = nil
+	}
+}
+
+// sshClientConfig authenticates with the key file and the keys of the SSH
+// agent, and verifies the host key against the known hosts file like ssh
+func sshClientConfig(cfg config.SSHConfig) (*ssh.ClientConfig, *sshAgent, error) {
+	username := cfg.User
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, nil, err
+		}
+		username = u.Username
+	}
+
+	knownHostsFile := cfg.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		b, err := ioutil.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse key file %s: %s", cfg.KeyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	var agentAuth *sshAgent
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		agentAuth = &sshAgent{sock: sock}
+		auth = append(auth, ssh.PublicKeysCallback(agentAuth.signers))
+	}
+	if len(auth) == 0 {
+		return nil, nil, fmt.Errorf("a key file or an SSH agent is required")
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshTunnelTimeout,
+	}, agentAuth, nil
+}
+
+// connect returns the connection to the SSH host, opening it if there is none
+func (t *sshTunnel) connect() (*ssh.Client, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.closed {
+		return nil, fmt.Errorf("SSH tunnel to %s closed", t.cfg.Host)
+	}
+	if t.client != nil {
+		return t.client, nil
+	}
+	client, err := ssh.Dial("tcp", t.addr, t.clientConfig)
+	if t.agentAuth != nil {
+		t.agentAuth.close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH host %s: %s", t.cfg.Host, err)
+	}
+	t.client = client
+	go t.keepAlive(client)
+	return client, nil
+}
+
+// close stops forwarding and drops the connection to the SSH host
+func (t *sshTunnel) close() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.closed = true
+	t.listener.Close()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+// keepAlive checks the connection to the SSH host and drops it once it is
+// lost, so the next forwarded connection opens a new one
+func (t *sshTunnel) keepAlive(client *ssh.Client) {
+	closed := make(chan error, 1)
+	go func() { closed <- client.Wait() }()
+
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-closed:
+			t.mtx.Lock()
+			if !t.closed {
+				log.Errorf("SSH connection to %s closed: %v", t.cfg.Host, err)
+			}
+			if t.client == client {
+				t.client = nil
+			}
+			t.mtx.Unlock()
+			return
+		case <-ticker.C:
+			reply := make(chan error, 1)
+			go func() {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				reply <- err
+			}()
+			select {
+			case err := <-reply:
+				if err != nil {
+					client.Close()
+				}
+			case <-time.After(sshKeepAliveInterval):
+				client.Close()
+			}
+		}
+	}
+}
+
+// serve forwards the connections to the local port
+func (t *sshTunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			t.mtx.Lock()
+			closed := t.closed
+			t.mtx.Unlock()
+			if !closed {
+				log.Errorf("SSH tunnel to %s stopped: %s", t.cfg.Host, err)
+			}
+			return
+		}
+		go t.forward(conn)
+	}
+}
+
+// forward copies the data of a local connection to the remote address and back
+func (t *sshTunnel) forward(conn net.Conn) {
+	defer conn.Close()
+	client, err := t.connect()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	remote, err := client.Dial("tcp", t.remote)
+	if err != nil {
+		log.Errorf("Failed to forward to %s through %s: %s", t.remote, t.cfg.Host, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/larseen/emq_exporter/pkg/collector"
+	"github.com/larseen/emq_exporter/pkg/config"
+	"github.com/larseen/emq_exporter/pkg/emqapi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// exporterPrefix is the prefix of the metrics about the exporter itself
+var exporterPrefix = collector.Namespace + "_exporter_"
+
+// target is a scraped EMQ node
+type target struct {
+	name string
+	// uri is the configured broker URL
+	uri       string
+	client    *emqapi.HTTPClient
+	collector *collector.Collector
+	// labels are the static labels of the target, sorted by name
+	labels []*dto.LabelPair
+	// cfg and opts build the collectors of other nodes, see forNode
+	cfg  *config.Config
+	opts collector.Options
+	// nodes are the targets of other nodes returned by forNode
+	nodes nodeTargets
+	// sshTunnel is the key of the SSH tunnel the target is forwarded
+	// through, empty if there is none
+	sshTunnel string
+}
+
+// maxNodeTargets is the number of targets of other nodes kept per target,
+// the least recently scraped ones are dropped beyond it
+const maxNodeTargets = 64
+
+// nodeTargets caches the targets of other nodes by node name, so their
+// collectors keep counting between the scrapes
+type nodeTargets struct {
+	mtx sync.Mutex
+	// lru holds the *nodeTarget entries, the most recently used first
+	lru    *list.List
+	byNode map[string]*list.Element
+}
+
+type nodeTarget struct {
+	node   string
+	target *target
+}
+
+// forNode returns the target scraping another node of the cluster through
+// the API of t, with a collector of its own
+func (t *target) forNode(node string) *target {
+	t.nodes.mtx.Lock()
+	defer t.nodes.mtx.Unlock()
+	if t.nodes.lru == nil {
+		t.nodes.lru = list.New()
+		t.nodes.byNode = make(map[string]*list.Element)
+	}
+	if e, ok := t.nodes.byNode[node]; ok {
+		t.nodes.lru.MoveToFront(e)
+		return e.Value.(*nodeTarget).target
+	}
+
+	opts := t.opts
+	// the stale cache of the target is not overwritten by other nodes
+	opts.StaleCacheFile = ""
+	emq := t.client.ForNode(node)
+	nt := &target{
+		name:      t.name,
+		uri:       t.uri,
+		client:    emq,
+		collector: collector.New(emq, t.cfg, opts),
+		labels:    t.labels,
+		cfg:       t.cfg,
+		opts:      opts,
+	}
+	t.nodes.byNode[node] = t.nodes.lru.PushFront(&nodeTarget{node: node, target: nt})
+	if t.nodes.lru.Len() > maxNodeTargets {
+		oldest := t.nodes.lru.Remove(t.nodes.lru.Back()).(*nodeTarget)
+		delete(t.nodes.byNode, oldest.node)
+	}
+	return nt
+}
+
+// contextCollector collects a target with the API requests bound to ctx
+type contextCollector struct {
+	collector *collector.Collector
+	ctx       context.Context
+}
+
+func (c *contextCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+func (c *contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collector.CollectContext(c.ctx, ch)
+}
+
+// targetSet gathers the metrics of all targets, labelling them with the
+// target name when it is set
+type targetSet struct {
+	targets []*target
+	// routeDivergence is the number of routes the nodes may differ by
+	// before the route tables are reported as inconsistent, the check is
+	// disabled if negative
+	routeDivergence int
+	// exporterVersion is added as exporter_version label to the EMQ
+	// metrics if set
+	exporterVersion string
+	// maxParallel is the maximum number of targets scraped at once
+	maxParallel int
+}
+
+func newTarget(tc config.TargetConfig, api *emqapi.APIVersion, cfg *config.Config, opts collector.Options, clientOpts emqapi.Options) (*target, error) {
+	u, err := emqapi.ParseURL(tc.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.NewTLSConfig(tc.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var sshTunnel string
+	if tc.SSH.Host != "" {
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		remote := net.JoinHostPort(u.Hostname(), port)
+		local, err := openSSHTunnel(tc.SSH, remote)
+		if err != nil {
+			return nil, err
+		}
+		sshTunnel = sshTunnelKey(tc.SSH, remote)
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		u.Host = local
+	}
+	clientOpts.Resolver = emqapi.NewResolver(clientOpts.DNSCacheTTL)
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		DialContext:     clientOpts.Resolver.DialContext,
+		TLSClientConfig: tlsConfig,
+	}
+	if tc.SOCKS5Proxy != "" {
+		proxy, err := config.ParseSOCKS5Proxy(tc.SOCKS5Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	httpClient := &http.Client{Transport: transport}
+
+	if tc.FallbackURI != "" {
+		fallback, err := emqapi.ParseURL(tc.FallbackURI)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts.FallbackURL = fallback
+	}
+
+	clientOpts.Timeouts = cfg.EndpointTimeouts()
+	clientOpts.APIKey = tc.APIKey
+	if tc.AuthMode != "" {
+		clientOpts.AuthMode = tc.AuthMode
+	}
+	emq := emqapi.New(httpClient, u, tc.Node, tc.Username, tc.Password, api, clientOpts)
+	c := collector.New(emq, cfg, opts)
+	if err := prometheus.NewRegistry().Register(c); err != nil {
+		return nil, err
+	}
+
+	labels := make([]*dto.LabelPair, 0, len(tc.Labels))
+	for name, value := range tc.Labels {
+		labels = append(labels, &dto.LabelPair{
+			Name:  stringPtr(name),
+			Value: stringPtr(value),
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+
+	return &target{
+		name:      tc.Name,
+		uri:       tc.URI,
+		client:    emq,
+		collector: c,
+		labels:    labels,
+		cfg:       cfg,
+		opts:      opts,
+		sshTunnel: sshTunnel,
+	}, nil
+}
+
+// inherit takes over the exporter metrics and detected API versions of the
+// targets of prev scraping the same nodes as the targets of ts
+func (ts *targetSet) inherit(prev *targetSet) {
+	for _, t := range ts.targets {
+		for _, p := range prev.targets {
+			if t.name == p.name && t.uri == p.uri && t.client.Node() == p.client.Node() {
+				t.client.InheritAPIVersion(p.client)
+				t.collector.Inherit(p.collector)
+				break
+			}
+		}
+	}
+}
+
+// buildTargets creates the targets of the configuration, or a single
+// target from the command line flags if none are configured
+func buildTargets(cfg *config.Config, defaults config.TargetConfig, api *emqapi.APIVersion, opts collector.Options, clientOpts emqapi.Options) (*targetSet, error) {
+	if len(cfg.Targets) == 0 {
+		t, err := newTarget(defaults, api, cfg, opts, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+		return &targetSet{targets: []*target{t}}, nil
+	}
+
+	ts := &targetSet{}
+	for _, tc := range cfg.Targets {
+		if tc.URI == "" {
+			tc.URI = defaults.URI
+			tc.FallbackURI = defaults.FallbackURI
+		}
+		if tc.Node == "" {
+			tc.Node = defaults.Node
+		}
+		if tc.SOCKS5Proxy == "" {
+			tc.SOCKS5Proxy = defaults.SOCKS5Proxy
+		}
+		if tc.TLS.ServerFingerprint == "" {
+			tc.TLS.ServerFingerprint = defaults.TLS.ServerFingerprint
+		}
+		if tc.SSH.Host == "" {
+			tc.SSH = defaults.SSH
+		}
+		if tc.Username == "" && tc.APIKey == "" {
+			tc.Username = defaults.Username
+			tc.Password = defaults.Password
+		}
+
+		targetOpts := opts
+		if opts.StaleCacheFile != "" {
+			targetOpts.StaleCacheFile = opts.StaleCacheFile + "." + tc.Name
+		}
+
+		t, err := newTarget(tc, api, cfg, targetOpts, clientOpts)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %s", tc.Name, err)
+		}
+		ts.targets = append(ts.targets, t)
+	}
+	return ts, nil
+}
+
+// appendMissingLabels appends the pairs of extra whose names are not in labels
+func appendMissingLabels(labels, extra []*dto.LabelPair) []*dto.LabelPair {
+	names := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		names[l.GetName()] = true
+	}
+	for _, e := range extra {
+		if !names[e.GetName()] {
+			labels = append(labels, e)
+		}
+	}
+	return labels
+}
+
+// Gather implements prometheus.Gatherer
+func (ts *targetSet) Gather() ([]*dto.MetricFamily, error) {
+	return ts.GatherContext(context.Background())
+}
+
+// GatherContext gathers the metrics of all targets with the API requests
+// bound to ctx. Like prometheus.Gatherers, the errors of some targets are
+// returned as prometheus.MultiError along with the metrics of the others.
+func (ts *targetSet) GatherContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	gathered := ts.gatherTargets(ctx)
+
+	families := make(map[string]*dto.MetricFamily)
+	var errs prometheus.MultiError
+	for i, t := range ts.targets {
+		if err := gathered[i].err; err != nil {
+			if t.name != "" {
+				err = fmt.Errorf("target %s: %s", t.name, err)
+			}
+			errs = append(errs, err)
+		}
+
+		for _, mf := range gathered[i].mfs {
+			var labels []*dto.LabelPair
+			if t.name != "" {
+				labels = append(labels, &dto.LabelPair{
+					Name:  stringPtr("target"),
+					Value: stringPtr(t.name),
+				})
+			}
+			if ts.exporterVersion != "" && !strings.HasPrefix(mf.GetName(), exporterPrefix) {
+				labels = append(labels, &dto.LabelPair{
+					Name:  stringPtr("exporter_version"),
+					Value: stringPtr(ts.exporterVersion),
+				})
+			}
+			if len(labels) > 0 || len(t.labels) > 0 {
+				for _, m := range mf.Metric {
+					m.Label = append(m.Label, labels...)
+					m.Label = appendMissingLabels(m.Label, t.labels)
+					sort.Slice(m.Label, func(i, j int) bool {
+						return m.Label[i].GetName() < m.Label[j].GetName()
+					})
+				}
+			}
+
+			if existing, ok := families[mf.GetName()]; ok {
+				existing.Metric = append(existing.Metric, mf.Metric...)
+				continue
+			}
+			families[mf.GetName()] = mf
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]*dto.MetricFamily, 0, len(names)+1)
+	for _, name := range names {
+		result = append(result, families[name])
+	}
+	if ts.routeDivergence >= 0 && len(ts.targets) > 1 {
+		if mf := routeConsistency(result, ts.routeDivergence); mf != nil {
+			result = append(result, mf)
+			sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+		}
+	}
+	if len(errs) > 0 {
+		return result, errs
+	}
+	return result, nil
+}
+
+// targetResult is the outcome of gathering a target
+type targetResult struct {
+	mfs []*dto.MetricFamily
+	err error
+}
+
+// gatherTargets gathers the targets in parallel, at most maxParallel at a
+// time, or all at once if maxParallel is not positive
+func (ts *targetSet) gatherTargets(ctx context.Context) []targetResult {
+	limit := ts.maxParallel
+	if limit <= 0 || limit > len(ts.targets) {
+		limit = len(ts.targets)
+	}
+	sem := make(chan struct{}, limit)
+
+	results := make([]targetResult, len(ts.targets))
+	var wg sync.WaitGroup
+	for i, t := range ts.targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t *target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			registry := prometheus.NewRegistry()
+			if err := registry.Register(&contextCollector{collector: t.collector, ctx: ctx}); err != nil {
+				results[i].err = err
+				return
+			}
+			results[i].mfs, results[i].err = registry.Gather()
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// only returns the set holding just the named target
+func (ts *targetSet) only(name string) (*targetSet, bool) {
+	for _, t := range ts.targets {
+		if t.name == name {
+			return &targetSet{targets: []*target{t}, routeDivergence: -1, exporterVersion: ts.exporterVersion}, true
+		}
+	}
+	return nil, false
+}
+
+// forNode returns the set scraping another node of the cluster of its only
+// target, false if the set has several targets
+func (ts *targetSet) forNode(node string) (*targetSet, bool) {
+	if len(ts.targets) != 1 {
+		return nil, false
+	}
+	return &targetSet{targets: []*target{ts.targets[0].forNode(node)}, routeDivergence: -1, exporterVersion: ts.exporterVersion}, true
+}
+
+// targetsGatherer serves the current target set, which is replaced on reload
+type targetsGatherer struct {
+	mtx sync.RWMutex
+	set *targetSet
+}
+
+func (g *targetsGatherer) swap(set *targetSet) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.set = set
+}
+
+// Gather implements prometheus.Gatherer
+func (g *targetsGatherer) Gather() ([]*dto.MetricFamily, error) {
+	return g.GatherContext(context.Background())
+}
+
+// GatherContext gathers the current targets with the API requests bound to ctx
+func (g *targetsGatherer) GatherContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	return g.current().GatherContext(ctx)
+}
+
+func (g *targetsGatherer) current() *targetSet {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	return g.set
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
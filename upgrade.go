@@ -0,0 +1,148 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// upgradeReadyEnv is the file descriptor of the pipe the new process
+// signals its readiness on
+const upgradeReadyEnv = "EMQ_EXPORTER_READY_FD"
+
+// upgradeTimeout is how long the new process may take to get ready before
+// the upgrade is given up
+const upgradeTimeout = time.Minute
+
+// handleUpgrades starts a new process of the exporter binary on SIGUSR2,
+// which takes over the open listeners, and calls quit once it is ready.
+// The old process keeps serving if the new one fails to start, or if the
+// signal arrives before it listens on all addresses.
+func handleUpgrades(quit func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+	go func() {
+		for range sig {
+			log.Infoln("Upgrading the exporter")
+			if err := upgrade(); err != nil {
+				log.Errorf("Failed to upgrade the exporter: %s", err)
+				continue
+			}
+			log.Infoln("The upgraded exporter is ready")
+			signal.Stop(sig)
+			quit()
+			return
+		}
+	}()
+}
+
+// upgrade starts the binary of the exporter again with the same arguments
+// and waits until it is ready
+func upgrade() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	listeners, ok := completeListeners()
+	if !ok {
+		return fmt.Errorf("the exporter is not listening on all addresses yet")
+	}
+	names := make([]string, 0, len(listeners))
+	for _, nl := range listeners {
+		fl, ok := nl.l.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return fmt.Errorf("the %s listener %s cannot be handed over", nl.name, nl.l.Addr())
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		names = append(names, nl.name)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	env := []string{
+		inheritedListenersEnv + "=" + strings.Join(names, ","),
+		upgradeReadyEnv + "=" + strconv.Itoa(systemdListenFDsStart+len(names)),
+	}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, inheritedListenersEnv+"=") && !strings.HasPrefix(kv, upgradeReadyEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// only the new process may hold the write end, so the read below ends
+	// when it exits
+	w.Close()
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		if err == io.EOF {
+			err = fmt.Errorf("the new process exited before it was ready")
+		}
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(upgradeTimeout):
+		err = fmt.Errorf("the new process was not ready within %s", upgradeTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+// upgradeReady tells the previous process that this one serves the handed
+// over listeners, if it was started by an upgrade
+func upgradeReady() {
+	fd, err := strconv.Atoi(os.Getenv(upgradeReadyEnv))
+	if err != nil {
+		return
+	}
+	os.Unsetenv(upgradeReadyEnv)
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		log.Warnf("Failed to signal readiness to the previous process: %s", err)
+	}
+}
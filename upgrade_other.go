@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package main
+
+import (
+	"github.com/prometheus/common/log"
+)
+
+// handleUpgrades is not supported on platforms without SIGUSR2
+func handleUpgrades(quit func()) {
+	log.Warnln("Upgrades are not supported on this platform")
+}
+
+// upgradeReady does nothing, the process cannot have been upgraded
+func upgradeReady() {}